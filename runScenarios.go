@@ -0,0 +1,41 @@
+package main
+
+/*
+	Runs the test harness scenarios, several simulated elevators in this
+	process, and prints what happened. Exits with status 1 if any failed.
+	Run with: go run runScenarios.go [name of scenario]
+	The same scenarios run as subtests with: go test harness
+*/
+
+import (
+	"fmt"
+	"harness"
+	"os"
+	"strings"
+)
+
+func main() {
+	failed := 0
+	for _, scenario := range harness.Scenarios {
+		if len(os.Args) > 1 && !strings.Contains(scenario.Name, os.Args[1]) {
+			continue
+		}
+		fmt.Printf("RUNSCENARIOS:\t Running %q\n", scenario.Name)
+		result := harness.Run(scenario)
+		for _, order := range result.Orders {
+			fmt.Printf("\t%s\n", order)
+		}
+		if result.Passed() {
+			fmt.Printf("RUNSCENARIOS:\t PASS %q\n", scenario.Name)
+		} else {
+			failed++
+			for _, violation := range result.Violations {
+				fmt.Printf("\t%s\n", violation)
+			}
+			fmt.Printf("RUNSCENARIOS:\t FAIL %q\n", scenario.Name)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,367 @@
+package config
+
+/*
+	This module is the one configuration of an elevator, with a section for
+	each module. It is loaded from a JSON file, and every setting can be
+	overridden by an environment variable or a command-line flag, see load.go.
+	The config is validated when it is loaded, so a bad setting stops the
+	elevator at startup instead of when it is running.
+	The modules do not read the config themselves. Each gets its section as
+	its own Config type, from the functions at the bottom of this file.
+*/
+
+import (
+	"elevator"
+	"errors"
+	"fmt"
+	"hardware"
+	"network"
+	"node"
+	"parking"
+	"simelev"
+	"time"
+	"traffic"
+	"typedef"
+	"udp"
+)
+
+type Config struct {
+	Network  Network
+	Hardware Hardware
+	Elevator Elevator
+	Parking  Parking
+	Traffic  Traffic
+	Sim      Sim
+}
+
+// The network and udp modules.
+type Network struct {
+	LocalListenPort     int
+	BroadcastListenPort int
+	MessageSize         int
+	BindAddress         string // "" finds the IP of the network.
+	BroadcastAddress    string // "" is 255.255.255.255.
+	Loopback            bool   // Only talk to elevators on this machine.
+	ReusePort           bool
+	PortOffset          int
+	LocalElevators      int
+	MulticastGroup      string // "" is broadcast.
+	MulticastTTL        int
+	MulticastInterface  string
+	ReceiveQueueSize    int
+	Codec               string // "json" or "binary".
+	MaxPacketSize       int    // 0 is the default of the network module. With a key the packets carry its header on top, and must fit in MessageSize.
+	Key                 string // Authenticate the messages with this key. "" is no authentication.
+	GroupID             string // The elevators with the same key and group ID talk to each other.
+}
+
+// The hardware module.
+type Hardware struct {
+	PollingDelay        Duration
+	MotorSpeed          int
+	ButtonDebounce      Duration // How long an input must read the same before it changes.
+	StopDebounce        Duration
+	ObstructionDebounce Duration
+	LongPress           Duration // How long a button is held for a long press.
+	LampCheckInterval   Duration // Between each readback of the lamps.
+	MotorTimeout        Duration // How long the floor sensors may stay the same while the motor runs.
+	MotorRetries        int      // How many times a failed motor command is given again.
+	AccelerationTime    Duration // From the creep speed to the motor speed when the car starts. 0, the default, starts at full speed.
+	DecelerationTime    Duration // Down to the creep speed before the floor the car stops at. 0, the default, stops from full speed.
+	CreepSpeed          int
+	RampCurve           string // "linear" or "smooth".
+	DoorButtons         bool   // The elevator has door open and close buttons.
+	RecallSwitch        bool   // The elevator has a fire recall key switch.
+	LoadSensor          bool   // The car has a load sensor, which reads the load in kg.
+}
+
+// The elevator module.
+type Elevator struct {
+	Floors              int // Must be typedef.N_FLOORS, which the elevator is built for.
+	DoorOpenTime        Duration
+	DoorOpenTimeAtFloor Duration
+	MaxDoorHoldTime     Duration // How long the door may be held open before it is nudged closed.
+	NudgeTime           Duration
+	StateFile           string   // "" keeps the cab orders nowhere.
+	RecallFloor         int      // Where the cars go in a fire recall.
+	Capacity            int      // The rated load of the car in kg, used with hardware.load-sensor.
+	FullLoad            int      // The load in percent of the capacity above which the car passes hall calls by.
+	DoublePressTime     Duration // How soon a cab button pressed again cancels its order.
+	NuisanceStops       int      // The stops in a row where nobody gets on or off before the cab orders are cancelled, 0 for never. Needs hardware.load-sensor.
+}
+
+// Where the idle cars park, in the elevator and group modules.
+type Parking struct {
+	IdleTime  Duration // 0 parks no cars, but in the traffic peaks after traffic.idle-time.
+	Floors    string   // The park floors, the home floor first, like "0,2".
+	Schedules string   // Other park floors at times of the day, like "07:00-10:00=0; 16:00-18:00=3".
+}
+
+// The traffic mode of the group module.
+type Traffic struct {
+	Lobby     int
+	Window    Duration // How far back the hall calls are counted. 0 only uses the schedules.
+	MinCalls  int      // The fewest hall calls in the window for a peak.
+	PeakShare float64  // The share of the hall calls at the lobby going up, or above it going down, for a peak.
+	Schedules string   // The modes at times of the day, like "07:30-09:30=up-peak; 16:00-18:00=down-peak".
+	IdleTime  Duration // How long a car waits without orders before it parks in a peak, when parking.idle-time is 0. 0 does not park.
+}
+
+// The simulated elevator, the settings of simulator.con.
+type Sim struct {
+	TravelTimeBetweenFloors Duration
+	TravelTimePassingFloor  Duration
+	ButtonDepressedTime     Duration
+	StartFloor              float64
+	PassengerWeight         int // In kg, for the load sensor.
+}
+
+var Default = Config{
+	Network: Network{
+		LocalListenPort:     network.DefaultUDPLocalListenPort,
+		BroadcastListenPort: network.DefaultUDPBroadcastListenPort,
+		MessageSize:         network.DefaultMessageSize,
+		Codec:               "json",
+		GroupID:             "elevators",
+	},
+	Hardware: Hardware{
+		PollingDelay:        Duration(10 * time.Millisecond),
+		MotorSpeed:          2800,
+		ButtonDebounce:      Duration(20 * time.Millisecond),
+		StopDebounce:        Duration(20 * time.Millisecond),
+		ObstructionDebounce: Duration(20 * time.Millisecond),
+		LongPress:           Duration(1500 * time.Millisecond),
+		LampCheckInterval:   Duration(500 * time.Millisecond),
+		MotorTimeout:        Duration(5 * time.Second),
+		MotorRetries:        2,
+		CreepSpeed:          700,
+		RampCurve:           "smooth",
+	},
+	Elevator: Elevator{
+		Floors:              typedef.N_FLOORS,
+		DoorOpenTime:        Duration(3 * time.Second),
+		DoorOpenTimeAtFloor: Duration(5 * time.Second),
+		MaxDoorHoldTime:     Duration(20 * time.Second),
+		NudgeTime:           Duration(3 * time.Second),
+		StateFile:           "elevator.state",
+		Capacity:            630,
+		FullLoad:            80,
+		DoublePressTime:     Duration(500 * time.Millisecond),
+	},
+	Parking: Parking{
+		Floors: "0",
+	},
+	Traffic: Traffic{
+		Window:    Duration(5 * time.Minute),
+		MinCalls:  10,
+		PeakShare: 0.6,
+		IdleTime:  Duration(10 * time.Second),
+	},
+	Sim: Sim{
+		TravelTimeBetweenFloors: Duration(simelev.DefaultConfig.TravelTimeBetweenFloors),
+		TravelTimePassingFloor:  Duration(simelev.DefaultConfig.TravelTimePassingFloor),
+		ButtonDepressedTime:     Duration(simelev.DefaultConfig.ButtonDepressedTime),
+		StartFloor:              simelev.DefaultConfig.StartFloor,
+		PassengerWeight:         simelev.DefaultConfig.PassengerWeight,
+	},
+}
+
+// The most an analog output of the IO card can be set to.
+const maxAnalogValue = 4095
+
+// Returns all that is wrong with the config, or nil.
+func (config Config) Validate() error {
+	var problems []error
+	check := func(ok bool, format string, v ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Errorf("CONFIG:\t "+format, v...))
+		}
+	}
+	n := config.Network
+	check(validPort(n.LocalListenPort), "network.local-listen-port %d is not a port.", n.LocalListenPort)
+	check(validPort(n.BroadcastListenPort), "network.broadcast-listen-port %d is not a port.", n.BroadcastListenPort)
+	check(n.LocalListenPort != n.BroadcastListenPort, "network.local-listen-port and network.broadcast-listen-port are both %d.", n.LocalListenPort)
+	check(n.PortOffset >= 0 && n.LocalElevators >= 0, "network.port-offset and network.local-elevators can not be negative.")
+	check(n.LocalElevators == 0 || n.PortOffset < n.LocalElevators, "network.port-offset %d is not one of the %d network.local-elevators.", n.PortOffset, n.LocalElevators)
+	check(n.MessageSize > 0, "network.message-size must be positive.")
+	packetSize := n.MaxPacketSize
+	if packetSize == 0 {
+		packetSize = network.DefaultMaxPacketSize
+	}
+	if n.Key != "" {
+		packetSize += network.AuthOverhead(n.GroupID)
+	}
+	check(n.MaxPacketSize >= 0, "network.max-packet-size can not be negative.")
+	check(packetSize <= n.MessageSize, "network.max-packet-size makes packets of %d bytes with the header of network.key, which do not fit in network.message-size %d.", packetSize, n.MessageSize)
+	check(n.MulticastTTL >= 0 && n.MulticastTTL <= 255, "network.multicast-ttl %d must be between 0 and 255.", n.MulticastTTL)
+	check(n.ReceiveQueueSize >= 0, "network.receive-queue-size can not be negative.")
+	_, err := network.CodecByName(n.Codec)
+	check(err == nil, "network.codec %q is not json or binary.", n.Codec)
+	check(n.Key == "" || n.GroupID != "", "network.group-id must be set with a network.key.")
+
+	h := config.Hardware
+	check(h.PollingDelay > 0, "hardware.polling-delay must be positive.")
+	check(h.MotorSpeed > 0 && h.MotorSpeed <= maxAnalogValue, "hardware.motor-speed %d must be between 1 and %d.", h.MotorSpeed, maxAnalogValue)
+	check(h.ButtonDebounce > 0 && h.StopDebounce > 0 && h.ObstructionDebounce > 0, "hardware.button-debounce, hardware.stop-debounce and hardware.obstruction-debounce must be positive.")
+	check(h.LampCheckInterval > 0, "hardware.lamp-check-interval must be positive.")
+	check(h.MotorTimeout > 0 && h.MotorRetries > 0, "hardware.motor-timeout and hardware.motor-retries must be positive.")
+	check(h.AccelerationTime >= 0 && h.DecelerationTime >= 0, "hardware.acceleration-time and hardware.deceleration-time can not be negative.")
+	check(h.CreepSpeed > 0 && h.CreepSpeed <= h.MotorSpeed, "hardware.creep-speed %d must be between 1 and hardware.motor-speed.", h.CreepSpeed)
+	_, err = hardware.RampCurveByName(h.RampCurve)
+	check(err == nil, "hardware.ramp-curve %q is not linear or smooth.", h.RampCurve)
+	check(h.LongPress > h.ButtonDebounce && h.LongPress > h.StopDebounce, "hardware.long-press must be longer than the debounce of the buttons.")
+
+	e := config.Elevator
+	check(e.Floors == typedef.N_FLOORS, "elevator.floors is %d, but the elevator is built for %d floors (typedef.N_FLOORS).", e.Floors, typedef.N_FLOORS)
+	check(e.DoorOpenTime > 0 && e.DoorOpenTimeAtFloor > 0, "elevator.door-open-time and elevator.door-open-time-at-floor must be positive.")
+	check(e.MaxDoorHoldTime > e.DoorOpenTime && e.MaxDoorHoldTime > e.DoorOpenTimeAtFloor, "elevator.max-door-hold-time must be longer than the door open times.")
+	check(e.NudgeTime > 0, "elevator.nudge-time must be positive.")
+	check(e.RecallFloor >= 0 && e.RecallFloor < e.Floors, "elevator.recall-floor %d is not in the building.", e.RecallFloor)
+	check(e.Capacity > 0 || (e.Capacity == 0 && !h.LoadSensor), "elevator.capacity must be positive with hardware.load-sensor.")
+	check(e.FullLoad > 0 && e.FullLoad <= 100, "elevator.full-load %d must be between 1 and 100 percent.", e.FullLoad)
+	check(e.DoublePressTime > 0, "elevator.double-press-time must be positive.")
+	check(e.NuisanceStops >= 0, "elevator.nuisance-stops can not be negative.")
+
+	p := config.Parking
+	check(p.IdleTime >= 0, "parking.idle-time can not be negative.")
+	_, err = parking.ParseFloors(p.Floors)
+	check(err == nil, "parking.floors %q must be floors in the building, like \"0,2\".", p.Floors)
+	_, err = parking.ParseSchedules(p.Schedules)
+	check(err == nil, "parking.schedules %q must be written like \"07:00-10:00=0; 16:00-18:00=3\".", p.Schedules)
+
+	t := config.Traffic
+	check(t.Lobby >= 0 && t.Lobby < e.Floors, "traffic.lobby %d is not in the building.", t.Lobby)
+	check(t.Window >= 0 && t.MinCalls >= 0 && t.IdleTime >= 0, "traffic.window, traffic.min-calls and traffic.idle-time can not be negative.")
+	check(t.PeakShare > 0 && t.PeakShare <= 1, "traffic.peak-share %v must be above 0 and at most 1.", t.PeakShare)
+	_, err = traffic.ParseSchedules(t.Schedules)
+	check(err == nil, "traffic.schedules %q must be written like \"07:30-09:30=up-peak; 16:00-18:00=down-peak\".", t.Schedules)
+
+	s := config.Sim
+	check(s.TravelTimeBetweenFloors > 0 && s.ButtonDepressedTime > 0, "sim.travel-time-between-floors and sim.button-depressed-time must be positive.")
+	check(s.TravelTimePassingFloor > 0 && s.TravelTimePassingFloor < s.TravelTimeBetweenFloors, "sim.travel-time-passing-floor must be positive and shorter than sim.travel-time-between-floors.")
+	check(s.StartFloor >= 0 && s.StartFloor <= float64(e.Floors-1), "sim.start-floor %v is not in the building.", s.StartFloor)
+	check(s.PassengerWeight > 0, "sim.passenger-weight must be positive.")
+	return errors.Join(problems...)
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// ----------------------- The sections of the modules ------------------------
+
+// The config of the udp module. Errors are reported on the channel, nil logs them.
+func (config Config) UDP(errorChannel chan<- error) udp.Config {
+	n := config.Network
+	return udp.Config{
+		LocalListenPort:     n.LocalListenPort,
+		BroadcastListenPort: n.BroadcastListenPort,
+		MessageSize:         n.MessageSize,
+		BindAddress:         n.BindAddress,
+		BroadcastAddress:    n.BroadcastAddress,
+		Loopback:            n.Loopback,
+		ReusePort:           n.ReusePort,
+		PortOffset:          n.PortOffset,
+		LocalElevators:      n.LocalElevators,
+		MulticastGroup:      n.MulticastGroup,
+		MulticastTTL:        n.MulticastTTL,
+		MulticastInterface:  n.MulticastInterface,
+		ReceiveQueueSize:    n.ReceiveQueueSize,
+		Errors:              errorChannel,
+	}
+}
+
+// The UDP sockets, under an Authenticator when there is a key.
+func (config Config) Transport(errorChannel chan<- error) (udp.Transport, error) {
+	transport := udp.ConfigTransport(config.UDP(errorChannel))
+	if config.Network.Key == "" {
+		return transport, nil
+	}
+	authenticator, err := network.NewAuthenticator([]byte(config.Network.Key), config.Network.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	return authenticator.Transport(transport), nil
+}
+
+// The config of a node, with the network, hardware and elevator sections. The errors of the network and hardware are reported on the channel.
+func (config Config) Node(errorChannel chan<- error) (node.Config, error) {
+	codec, err := network.CodecByName(config.Network.Codec)
+	if err != nil {
+		return node.Config{}, err
+	}
+	hardwareConfig := config.HardwareConfig()
+	hardwareConfig.Errors = errorChannel
+	return node.Config{
+		Hardware: hardwareConfig,
+		Elevator: config.ElevatorConfig(),
+		Network:  network.Config{Codec: codec, MaxPacketSize: config.Network.MaxPacketSize, Errors: errorChannel},
+		Traffic:  config.TrafficConfig(),
+	}, nil
+}
+
+func (config Config) HardwareConfig() hardware.Config {
+	h := config.Hardware
+	curve, _ := hardware.RampCurveByName(h.RampCurve) // Checked by Validate.
+	return hardware.Config{
+		PollingDelay:        time.Duration(h.PollingDelay),
+		MotorSpeed:          h.MotorSpeed,
+		ButtonDebounce:      time.Duration(h.ButtonDebounce),
+		StopDebounce:        time.Duration(h.StopDebounce),
+		ObstructionDebounce: time.Duration(h.ObstructionDebounce),
+		LongPress:           time.Duration(h.LongPress),
+		LampCheckInterval:   time.Duration(h.LampCheckInterval),
+		MotorTimeout:        time.Duration(h.MotorTimeout),
+		MotorRetries:        h.MotorRetries,
+		AccelerationTime:    time.Duration(h.AccelerationTime),
+		DecelerationTime:    time.Duration(h.DecelerationTime),
+		CreepSpeed:          h.CreepSpeed,
+		RampCurve:           curve,
+		DoorButtons:         h.DoorButtons,
+		RecallSwitch:        h.RecallSwitch,
+		LoadSensor:          h.LoadSensor,
+	}
+}
+
+// The config of the elevator module. The capacity is left 0 without a load sensor, which turns the load off.
+func (config Config) ElevatorConfig() elevator.Config {
+	capacity := 0
+	if config.Hardware.LoadSensor {
+		capacity = config.Elevator.Capacity
+	}
+	return elevator.Config{
+		DoorOpenTime:        time.Duration(config.Elevator.DoorOpenTime),
+		DoorOpenTimeAtFloor: time.Duration(config.Elevator.DoorOpenTimeAtFloor),
+		MaxDoorHoldTime:     time.Duration(config.Elevator.MaxDoorHoldTime),
+		NudgeTime:           time.Duration(config.Elevator.NudgeTime),
+		StateFile:           config.Elevator.StateFile,
+		RecallFloor:         config.Elevator.RecallFloor,
+		Capacity:            capacity,
+		FullLoad:            config.Elevator.FullLoad,
+		DoublePressTime:     time.Duration(config.Elevator.DoublePressTime),
+		NuisanceStops:       config.Elevator.NuisanceStops,
+		Parking:             config.ParkingPolicy(),
+	}
+}
+
+func (config Config) ParkingPolicy() parking.Policy {
+	floors, _ := parking.ParseFloors(config.Parking.Floors)          // Checked by Validate.
+	schedules, _ := parking.ParseSchedules(config.Parking.Schedules) // Checked by Validate.
+	return parking.Policy{IdleTime: time.Duration(config.Parking.IdleTime), Floors: floors, Schedules: schedules}
+}
+
+func (config Config) TrafficConfig() traffic.Config {
+	t := config.Traffic
+	schedules, _ := traffic.ParseSchedules(t.Schedules) // Checked by Validate.
+	return traffic.Config{Lobby: t.Lobby, Window: time.Duration(t.Window), MinCalls: t.MinCalls, PeakShare: t.PeakShare, Schedules: schedules, IdleTime: time.Duration(t.IdleTime)}
+}
+
+func (config Config) SimConfig() simelev.Config {
+	return simelev.Config{
+		TravelTimeBetweenFloors: time.Duration(config.Sim.TravelTimeBetweenFloors),
+		TravelTimePassingFloor:  time.Duration(config.Sim.TravelTimePassingFloor),
+		ButtonDepressedTime:     time.Duration(config.Sim.ButtonDepressedTime),
+		StartFloor:              config.Sim.StartFloor,
+		PassengerWeight:         config.Sim.PassengerWeight,
+	}
+}
@@ -0,0 +1,206 @@
+package config
+
+/*
+	The config is loaded in layers, each overriding the one before:
+		1. Default.
+		2. The JSON file given by the -config flag or ELEVATOR_CONFIG. It only
+		   has to have the settings which differ from the defaults, and an
+		   unknown setting is an error.
+		3. The environment, ELEVATOR_<SECTION>_<SETTING>, for example
+		   ELEVATOR_NETWORK_LOCAL_LISTEN_PORT=22311.
+		4. The flags, -<section>.<setting>, for example
+		   -network.local-listen-port=22311.
+	The durations are written like "1.5s" in all of them. elevator.json has
+	every setting with its default.
+*/
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const envPrefix = "ELEVATOR"
+const fileEnv = envPrefix + "_CONFIG"
+
+// A time.Duration written like "1.5s".
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	*d = Duration(duration)
+	return err
+}
+
+// The flags which override the config, from AddFlags.
+type Flags struct {
+	file      string
+	overrides map[string]string // The flags which were set, by the name of the setting.
+}
+
+/*
+	Adds the -config flag and a flag for every setting to the flag set. Call
+	Load after the flags have been parsed.
+*/
+func AddFlags(flags *flag.FlagSet) *Flags {
+	f := &Flags{overrides: make(map[string]string)}
+	flags.StringVar(&f.file, "config", "", "The config file. Also set by "+fileEnv+".")
+	defaults := Default
+	settings(&defaults, func(name, env string, value reflect.Value) {
+		setting := &settingFlag{name: name, defaultValue: format(value), isBool: value.Kind() == reflect.Bool, overrides: f.overrides}
+		flags.Var(setting, name, "Also set by "+env+".")
+	})
+	return f
+}
+
+// Loads the config from the file, the environment and the flags, and validates it.
+func (f *Flags) Load() (Config, error) {
+	config := Default
+	file := f.file
+	if file == "" {
+		file = os.Getenv(fileEnv)
+	}
+	if file != "" {
+		if err := loadFile(file, &config); err != nil {
+			return Config{}, err
+		}
+	}
+	var err error
+	settings(&config, func(name, env string, value reflect.Value) {
+		if s, ok := os.LookupEnv(env); ok && err == nil {
+			if setErr := set(value, s); setErr != nil {
+				err = fmt.Errorf("CONFIG:\t %s=%q: %v", env, s, setErr)
+			}
+		}
+		if s, ok := f.overrides[name]; ok && err == nil {
+			if setErr := set(value, s); setErr != nil {
+				err = fmt.Errorf("CONFIG:\t -%s=%q: %v", name, s, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+	return config, config.Validate()
+}
+
+func loadFile(file string, config *Config) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("CONFIG:\t Unable to read the config file: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("CONFIG:\t Unable to read the config file %s: %v", file, err)
+	}
+	return nil
+}
+
+// Calls f with the flag name, the environment variable and the value of every setting in the config.
+func settings(config *Config, f func(name, env string, value reflect.Value)) {
+	sections := reflect.ValueOf(config).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionName := sections.Type().Field(i).Name
+		for j := 0; j < section.NumField(); j++ {
+			setting := kebab(section.Type().Field(j).Name)
+			name := strings.ToLower(sectionName) + "." + setting
+			env := envPrefix + "_" + strings.ToUpper(sectionName+"_"+strings.ReplaceAll(setting, "-", "_"))
+			f(name, env, section.Field(j))
+		}
+	}
+}
+
+// "MulticastTTL" is "multicast-ttl".
+func kebab(name string) string {
+	runes := []rune(name)
+	var s strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			s.WriteRune('-')
+		}
+		s.WriteRune(unicode.ToLower(r))
+	}
+	return s.String()
+}
+
+// Sets a setting from the way it is written in a flag or the environment.
+func set(value reflect.Value, s string) error {
+	if unmarshaler, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(s))
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	default:
+		return fmt.Errorf("settings of type %s are not supported", value.Type())
+	}
+	return nil
+}
+
+func format(value reflect.Value) string {
+	return fmt.Sprint(value.Interface())
+}
+
+// A flag which keeps its value until Load, so it overrides the file and the environment.
+type settingFlag struct {
+	name         string
+	defaultValue string
+	isBool       bool
+	overrides    map[string]string
+}
+
+func (f *settingFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	if s, ok := f.overrides[f.name]; ok {
+		return s
+	}
+	return f.defaultValue
+}
+
+func (f *settingFlag) Set(s string) error {
+	f.overrides[f.name] = s
+	return nil
+}
+
+// Bool settings can be given as -network.loopback without a value.
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.isBool
+}
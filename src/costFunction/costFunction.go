@@ -7,13 +7,103 @@ package CostFunction
 	the compution of the cost function, then terminates.
 */
 
+import (
+	"typedef"
+)
+
+// The time it takes to travel between two floors, and to stop at a floor, counted in floors.
+const travelCost = 1
+const stopCost = 2
+
+// Added in down-peak for a car which must go up empty to a down call.
+const peakCost = typedef.N_FLOORS - 1
+
+// Added for a fully loaded car, in proportion to its load, as its passengers take longer to get on and off.
+const loadCost = 2 * stopCost
+
 /*
 	This is the function that is run as a goroutine(or not?). It takes the the floor
 	the elevator is being ordered to and the direction the "customer" wants
 	to go as arguments and calculates the optimal (at least we hope it does)
 	elevator to respond to the call.
+	The states are the known elevators by ip. If two elevators have the same
+	cost, the one with the lowest ip is chosen, so every elevator calculating
+	this gets the same answer. The traffic mode is the one of the group, in
+	down-peak the down calls are given to the cars above them, which are on
+	their way down anyway.
 */
-func calculateRespondingElevator(floor, direction int) (elevator int) {
-	// TODO -> Implement some algorithm to calculate the optimal elevator
+func CalculateRespondingElevator(floor, buttonType int, states map[string]typedef.ElevatorState, traffic int) (elevator string) {
+	bestCost := -1
+	for ip, state := range states {
+		cost := calculateCost(floor, buttonType, state)
+		if traffic == typedef.TrafficDownPeak && buttonType == typedef.BUTTON_CALL_DOWN && state.Lastfloor < floor {
+			cost += peakCost
+		}
+		if bestCost == -1 || cost < bestCost || (cost == bestCost && ip < elevator) {
+			bestCost = cost
+			elevator = ip
+		}
+	}
+	return elevator
+}
 
+/*
+	Chooses the elevator for a passenger at a destination dispatch panel.
+	The passengers are grouped by destination: a car which picks up at the
+	origin for the same destination takes the passenger too, and otherwise a
+	car which stops at the destination anyway costs one stop less than one
+	which must make a new stop for it. Ties are broken like above.
+*/
+func CalculateDestinationElevator(call typedef.DestinationCall, states map[string]typedef.ElevatorState, traffic int) (elevator string) {
+	buttonType := typedef.BUTTON_CALL_UP
+	if call.Destination < call.Origin {
+		buttonType = typedef.BUTTON_CALL_DOWN
+	}
+	bestCost := -1
+	for ip, state := range states {
+		cost := calculateCost(call.Origin, buttonType, state)
+		if state.InternalOrders[call.Origin] && state.Destinations[call.Destination] {
+			cost = 0
+		} else if !state.InternalOrders[call.Destination] && !state.Destinations[call.Destination] {
+			cost += stopCost
+		}
+		if traffic == typedef.TrafficDownPeak && buttonType == typedef.BUTTON_CALL_DOWN && state.Lastfloor < call.Origin {
+			cost += peakCost
+		}
+		if bestCost == -1 || cost < bestCost || (cost == bestCost && ip < elevator) {
+			bestCost = cost
+			elevator = ip
+		}
+	}
+	return elevator
+}
+
+/*
+	Estimates how long it takes the elevator to arrive at the floor, as the
+	number of floors it travels plus the number of stops it makes on the way.
+	Elevators moving away from the floor must first finish their orders in that
+	direction, and full elevators passing the call by must also come back for
+	it. The load of the elevator is added on top.
+*/
+func calculateCost(floor, buttonType int, state typedef.ElevatorState) int {
+	distance := floor - state.Lastfloor
+	if distance < 0 {
+		distance = -distance
+	}
+	cost := distance * travelCost
+	movingAway := (state.Direction == typedef.DIR_UP && floor < state.Lastfloor) ||
+		(state.Direction == typedef.DIR_DOWN && floor > state.Lastfloor)
+	if movingAway || state.Passes(buttonType) {
+		cost += 2 * (typedef.N_FLOORS - 1) * travelCost
+	}
+	cost += state.Load * loadCost / 100
+	for f := 0; f < typedef.N_FLOORS; f++ {
+		if state.InternalOrders[f] || state.ExternalOrders[f][typedef.BUTTON_CALL_UP] || state.ExternalOrders[f][typedef.BUTTON_CALL_DOWN] || state.Destinations[f] {
+			cost += stopCost
+		}
+	}
+	if state.OpenDoor {
+		cost += stopCost
+	}
+	return cost
 }
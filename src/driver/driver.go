@@ -44,3 +44,16 @@ func IOWriteAnalog(channel, value int) {
 func IOReadAnalog(channel int) int {
 	return int(C.io_read_analog(C.int(channel)))
 }
+
+/*
+	Comedi is the elevator IO card, for use by the hardware module.
+	It only wraps the functions above, so there is only one card per process.
+*/
+type Comedi struct{}
+
+func (Comedi) Init() error                    { return IOInit() }
+func (Comedi) SetBit(channel int)             { IOSetBit(channel) }
+func (Comedi) ClearBit(channel int)           { IOClearBit(channel) }
+func (Comedi) ReadBit(channel int) bool       { return IOReadBit(channel) }
+func (Comedi) WriteAnalog(channel, value int) { IOWriteAnalog(channel, value) }
+func (Comedi) ReadAnalog(channel int) int     { return IOReadAnalog(channel) }
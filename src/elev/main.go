@@ -0,0 +1,136 @@
+package main
+
+/*
+	The elevator program, one command for everything that runs on an elevator:
+		elev run          A networked elevator, one of the group.
+		elev single       An elevator on its own, serving its own hall calls.
+		elev sim          A networked elevator on a simulated car, with the
+		                  buttons pressed from the keyboard.
+		elev reset        Stops the motor and turns off the lamps.
+		elev listen       Prints the messages of the elevators on the network.
+		elev recall       Turns the fire recall of the group on or off.
+		elev service      Takes an elevator out of the group, or back.
+		elev destination  Asks for a car from one floor to another.
+		elev selftest     Tests the lamps, motor and floor sensors.
+	Build it with "go build elev" from the root of the repository, with
+	GOPATH set to it. Every command takes the shared flags:
+		-config, and a flag for every setting, see the config module.
+		-backend comedi or sim, the IO card or a simulated elevator.
+		-log, a file to write the log to instead of stderr.
+		-v, print the state of the elevator when it changes.
+	Run "elev <command> -h" for all the flags.
+*/
+
+import (
+	"config"
+	"driver"
+	"flag"
+	"fmt"
+	"hardware"
+	"log"
+	"os"
+	"simelev"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(shared *shared, args []string) error
+}
+
+var commands = []command{
+	{"run", "A networked elevator, one of the group.", runCommand},
+	{"single", "An elevator on its own, serving its own hall calls.", singleCommand},
+	{"sim", "A networked elevator on a simulated car, controlled from the keyboard.", simCommand},
+	{"reset", "Stops the motor and turns off the lamps.", resetCommand},
+	{"listen", "Prints the messages of the elevators on the network.", listenCommand},
+	{"recall", "Turns the fire recall of the group on or off: elev recall on|off.", recallCommand},
+	{"service", "Takes an elevator out of the group, or back: elev service <ip> normal|maintenance|inspection|independent.", serviceCommand},
+	{"destination", "Asks for a car from one floor to another: elev destination <from> <to>.", destinationCommand},
+	{"selftest", "Tests the lamps, motor and floor sensors.", selftestCommand},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			flags := flag.NewFlagSet("elev "+c.name, flag.ExitOnError)
+			shared := addSharedFlags(flags)
+			if err := flags.Parse(os.Args[2:]); err != nil {
+				os.Exit(2)
+			}
+			if err := shared.load(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			if err := c.run(shared, flags.Args()); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: elev <command> [flags]")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-11s %s\n", c.name, c.description)
+	}
+}
+
+// The flags of every command.
+type shared struct {
+	configFlags *config.Flags
+	backend     string
+	logFile     string
+	verbose     bool
+	config      config.Config
+}
+
+func addSharedFlags(flags *flag.FlagSet) *shared {
+	s := &shared{configFlags: config.AddFlags(flags)}
+	flags.StringVar(&s.backend, "backend", "comedi", "The elevator to run: comedi, the IO card, or sim, a simulated elevator.")
+	flags.StringVar(&s.logFile, "log", "", "Write the log to this file instead of stderr.")
+	flags.BoolVar(&s.verbose, "v", false, "Print the state of the elevator when it changes.")
+	return s
+}
+
+// Loads the config and sets up the log, after the flags have been parsed.
+func (s *shared) load() error {
+	if s.backend != "comedi" && s.backend != "sim" {
+		return fmt.Errorf("ELEV:\t There is no backend %q, use comedi or sim.", s.backend)
+	}
+	var err error
+	if s.config, err = s.configFlags.Load(); err != nil {
+		return err
+	}
+	// The simulated car has the door buttons, the recall key switch and the load sensor the lab elevators lack.
+	if s.backend == "sim" {
+		s.config.Hardware.DoorButtons = true
+		s.config.Hardware.RecallSwitch = true
+		s.config.Hardware.LoadSensor = true
+	}
+	if s.logFile != "" {
+		file, err := os.OpenFile(s.logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		log.SetOutput(file)
+	}
+	return nil
+}
+
+// The IO of the backend. The simulated elevator is also returned with the sim backend, so it can be controlled.
+func (s *shared) io() (hardware.IODevice, *simelev.Elevator) {
+	if s.backend == "sim" {
+		sim := simelev.New(s.config.SimConfig())
+		return sim, sim
+	}
+	return driver.Comedi{}, nil
+}
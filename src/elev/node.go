@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hardware"
+	"log"
+	"node"
+	"os"
+	"os/signal"
+	"simelev"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"typedef"
+)
+
+// How often the state is checked for changes with -v.
+const stateInterval = 200 * time.Millisecond
+
+func runCommand(shared *shared, args []string) error {
+	io, _ := shared.io()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	n, err := startNode(ctx, shared, io)
+	if err != nil {
+		return err
+	}
+	watchNode(ctx, shared, n)
+	return nil
+}
+
+/*
+	Runs a networked elevator on a simulated car. The buttons are pressed by
+	lines on stdin, see simHelp.
+*/
+func simCommand(shared *shared, args []string) error {
+	shared.backend = "sim"
+	io, sim := shared.io()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	n, err := startNode(ctx, shared, io)
+	if err != nil {
+		return err
+	}
+	fmt.Print(simHelp)
+	go readKeyboard(sim, stop)
+	watchNode(ctx, shared, n)
+	return nil
+}
+
+// The node of the config on the io. The errors of the network are logged.
+func startNode(ctx context.Context, shared *shared, io hardware.IODevice) (*node.Node, error) {
+	errorChannel := make(chan error, 16)
+	transport, err := shared.config.Transport(errorChannel)
+	if err != nil {
+		return nil, err
+	}
+	nodeConfig, err := shared.config.Node(errorChannel)
+	if err != nil {
+		return nil, err
+	}
+	n, err := node.Start(ctx, io, transport, nodeConfig)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("ELEV:\t Running as %s.\n", n.IP)
+	go func() {
+		for {
+			select {
+			case err := <-errorChannel:
+				log.Println(err)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return n, nil
+}
+
+// Prints the state of the node when it changes with -v, until it has stopped.
+func watchNode(ctx context.Context, shared *shared, n *node.Node) {
+	ticker := time.NewTicker(stateInterval)
+	defer ticker.Stop()
+	var last typedef.ElevatorState
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("ELEV:\t Stopping.")
+			n.Wait()
+			return
+		case <-ticker.C:
+			if state := n.State(); shared.verbose && state != last {
+				state.PrintState()
+				last = state
+			}
+		}
+	}
+}
+
+const simHelp = `Press the buttons of the simulated elevator with:
+	up <floor>, down <floor>, cab <floor>, open, close, stop, obstruction, recall, load <kg>, quit
+`
+
+// Reads the commands for the simulated car from stdin. Quit stops the elevator.
+func readKeyboard(sim *simelev.Elevator, stop func()) {
+	stopped, obstructed, recalled := false, false, false
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "up", "down", "cab":
+			floor, err := strconv.Atoi(strings.Join(words[1:], ""))
+			if err != nil || floor < 0 || floor >= typedef.N_FLOORS {
+				fmt.Printf("There is no floor %q.\n", strings.Join(words[1:], " "))
+				continue
+			}
+			buttonType := map[string]int{"up": typedef.BUTTON_CALL_UP, "down": typedef.BUTTON_CALL_DOWN, "cab": typedef.BUTTON_COMMAND}[words[0]]
+			sim.Press(buttonType, floor)
+		case "open":
+			sim.Press(typedef.BUTTON_DOOR_OPEN, 0)
+		case "close":
+			sim.Press(typedef.BUTTON_DOOR_CLOSE, 0)
+		case "stop":
+			stopped = !stopped
+			sim.SetStop(stopped)
+		case "obstruction":
+			obstructed = !obstructed
+			sim.SetObstruction(obstructed)
+		case "recall":
+			recalled = !recalled
+			sim.SetRecallSwitch(recalled)
+		case "load":
+			kg, err := strconv.Atoi(strings.Join(words[1:], ""))
+			if err != nil || kg < 0 {
+				fmt.Printf("There is no load %q.\n", strings.Join(words[1:], " "))
+				continue
+			}
+			sim.SetLoad(kg)
+		case "quit":
+			stop()
+			return
+		default:
+			fmt.Print(simHelp)
+		}
+	}
+}
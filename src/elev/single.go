@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"elevator"
+	"hardware"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"typedef"
+)
+
+/*
+	Runs one elevator on its own, serving its own hall calls. On SIGINT or
+	SIGTERM the cab orders are saved and the motor is stopped before exiting.
+*/
+func singleCommand(shared *shared, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	buttonChannel := make(chan hardware.ButtonEvent, 1)
+	lightChannel := make(chan hardware.LightEvent, 3)
+	motorChannel := make(chan hardware.MotorEvent, 1)
+	floorChannel := make(chan hardware.FloorEvent, 1)
+	faultChannel := make(chan hardware.FaultEvent, 1)
+	stateChannel := make(chan typedef.ElevatorState, 1)
+	loadChannel := make(chan int, 1)
+
+	// The modules are stopped one by one below, the elevator before the hardware.
+	modulesCtx := context.WithoutCancel(ctx)
+	io, _ := shared.io()
+	hardwareConfig := shared.config.HardwareConfig()
+	hardwareConfig.Faults = faultChannel
+	hardwareConfig.Load = loadChannel
+	hardwareHandle, err := hardware.New(io).Start(modulesCtx, buttonChannel, lightChannel, motorChannel, floorChannel, hardwareConfig)
+	if err != nil {
+		return err
+	}
+	elevatorHandle := elevator.Start(modulesCtx, elevator.Channels{
+		Button: buttonChannel,
+		Light:  lightChannel,
+		Motor:  motorChannel,
+		Floor:  floorChannel,
+		State:  stateChannel,
+		Fault:  faultChannel,
+		Load:   loadChannel,
+	}, shared.config.ElevatorConfig())
+
+	for {
+		select {
+		case state := <-stateChannel:
+			if shared.verbose {
+				state.PrintState()
+			}
+		case <-ctx.Done():
+			log.Println("ELEV:\t Stopping.")
+			elevatorHandle.Close()
+			hardwareHandle.Close()
+			return nil
+		}
+	}
+}
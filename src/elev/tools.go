@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hardware"
+	"network"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+	"traffic"
+	"typedef"
+)
+
+// Stops the motor and turns off all the lamps, when the elevator has been left running.
+func resetCommand(shared *shared, args []string) error {
+	io, _ := shared.io()
+	return hardware.New(io).Reset()
+}
+
+func selftestCommand(shared *shared, args []string) error {
+	io, _ := shared.io()
+	err := hardware.New(io).SelfTest(shared.config.HardwareConfig(), func(step string) {
+		fmt.Println("SELFTEST:\t", step)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("SELFTEST:\t Passed.")
+	return nil
+}
+
+var eventNames = map[int]string{
+	typedef.EventNotifyAlive:               "alive",
+	typedef.EventBackup:                    "backup",
+	typedef.EventRequestState:              "request state",
+	typedef.EventReturnRestoredState:       "restored state",
+	typedef.EventNewOrder:                  "new order",
+	typedef.EventConfirmOrder:              "confirm order",
+	typedef.EventAcknowledgeConfirmedOrder: "acknowledge order",
+	typedef.EventOrderDone:                 "order done",
+	typedef.EventAcknowledgeOrderDone:      "acknowledge done",
+	typedef.EventReassignOrder:             "reassign order",
+	typedef.EventLeaving:                   "leaving",
+	typedef.EventRecall:                    "recall",
+	typedef.EventService:                   "service",
+	typedef.EventDestinationCall:           "destination call",
+	typedef.EventDestinationAssigned:       "destination taken",
+	typedef.EventDestinationConfirmed:      "destination confirmed",
+}
+
+/*
+	Prints the messages of the elevators on the network, decoded, until SIGINT.
+	It takes the ports of an elevator, so on the machine of one use another
+	-network.port-offset or -network.reuse-port. The alive messages are only
+	printed with -v.
+*/
+func listenCommand(shared *shared, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errorChannel := make(chan error, 16)
+	transport, err := shared.config.Transport(errorChannel)
+	if err != nil {
+		return err
+	}
+	nodeConfig, err := shared.config.Node(errorChannel)
+	if err != nil {
+		return err
+	}
+	receiveChannel := make(chan typedef.ElevatorMessage, 10)
+	localIP, handle, err := network.Start(ctx, transport, nodeConfig.Network, receiveChannel, make(chan typedef.ElevatorMessage))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("LISTEN:\t Listening as %s.\n", localIP)
+	for {
+		select {
+		case <-ctx.Done():
+			handle.Wait()
+			return nil
+		case err := <-errorChannel:
+			fmt.Println(err)
+		case message := <-receiveChannel:
+			if message.Event == typedef.EventNotifyAlive && !shared.verbose {
+				continue
+			}
+			fmt.Printf("LISTEN:\t %-15s from %s", eventNames[message.Event], message.SenderIp)
+			if message.Event == typedef.EventRecall {
+				fmt.Printf(", on %t", message.Order.Value)
+			} else if message.Event == typedef.EventDestinationCall || message.Event == typedef.EventDestinationAssigned || message.Event == typedef.EventDestinationConfirmed {
+				fmt.Printf(", from floor %d to %d, call %d", message.Call.Origin, message.Call.Destination, message.Call.Number)
+			} else if message.Event == typedef.EventService {
+				fmt.Printf(", %s service for %s", typedef.ServiceName(message.State.Service), message.AssignedTo)
+			} else if message.Event != typedef.EventNotifyAlive {
+				fmt.Printf(", floor %d button %d", message.Order.Floor, message.Order.ButtonType)
+			}
+			if message.AssignedTo != "" && message.Event != typedef.EventService {
+				fmt.Printf(", assigned to %s", message.AssignedTo)
+			}
+			fmt.Printf(", at floor %d going %d", message.State.Lastfloor, message.State.Direction)
+			if message.Event == typedef.EventNotifyAlive {
+				fmt.Printf(", %s traffic", traffic.ModeName(message.Traffic))
+				if message.State.Service != typedef.ServiceNormal {
+					fmt.Printf(", in %s service", typedef.ServiceName(message.State.Service))
+				}
+				if message.State.Full {
+					fmt.Printf(", full")
+				}
+			}
+			fmt.Println()
+		}
+	}
+}
+
+const commandRepeats = 5 // A command is sent a few times, in case one is lost.
+const commandInterval = 100 * time.Millisecond
+
+/*
+	Turns the fire recall of the group on or off, with "on" or "off". Every
+	elevator which hears the command tells the others, so it only has to
+	reach one of them. It takes the ports of an elevator, like listen.
+*/
+func recallCommand(shared *shared, args []string) error {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return fmt.Errorf("ELEV:\t Usage: elev recall on|off")
+	}
+	err := sendCommand(shared, typedef.ElevatorMessage{Event: typedef.EventRecall, Order: typedef.Order{Value: args[0] == "on"}}, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("RECALL:\t Sent the fire recall %s.\n", args[0])
+	return nil
+}
+
+/*
+	Puts the elevator with the ip in a service mode: normal, maintenance,
+	inspection or independent. It takes the ports of an elevator, like listen.
+*/
+func serviceCommand(shared *shared, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ELEV:\t Usage: elev service <ip> normal|maintenance|inspection|independent")
+	}
+	mode, err := typedef.ServiceByName(args[1])
+	if err != nil {
+		return fmt.Errorf("ELEV:\t %v", err)
+	}
+	err = sendCommand(shared, typedef.ElevatorMessage{Event: typedef.EventService, AssignedTo: args[0], State: typedef.ElevatorState{Service: mode}}, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("SERVICE:\t Sent %s service to %s.\n", args[1], args[0])
+	return nil
+}
+
+/*
+	A destination dispatch panel: asks for a car from one floor to another,
+	and prints the car which confirms it took the call. A new panel is made
+	for every call, so the call is numbered by the clock.
+*/
+func destinationCommand(shared *shared, args []string) error {
+	var call typedef.DestinationCall
+	var err1, err2 error
+	if len(args) == 2 {
+		call.Origin, err1 = strconv.Atoi(args[0])
+		call.Destination, err2 = strconv.Atoi(args[1])
+	}
+	if len(args) != 2 || err1 != nil || err2 != nil {
+		return fmt.Errorf("ELEV:\t Usage: elev destination <from floor> <to floor>")
+	} else if call.Origin < 0 || call.Origin >= typedef.N_FLOORS || call.Destination < 0 || call.Destination >= typedef.N_FLOORS || call.Origin == call.Destination {
+		return fmt.Errorf("ELEV:\t There is no trip from floor %d to floor %d.", call.Origin, call.Destination)
+	}
+	call.Number = int(time.Now().UnixNano())
+	car := ""
+	err := sendCommand(shared, typedef.ElevatorMessage{Event: typedef.EventDestinationCall, Call: call}, func(message typedef.ElevatorMessage) bool {
+		answer := message.Call
+		if message.Event == typedef.EventDestinationConfirmed && answer.Number == call.Number && answer.Origin == call.Origin && answer.Destination == call.Destination {
+			car = message.SenderIp
+		}
+		return car != ""
+	})
+	if err != nil {
+		return err
+	} else if car == "" {
+		return fmt.Errorf("ELEV:\t No car confirmed the call.")
+	}
+	fmt.Printf("DESTINATION:\t Take the car %s.\n", car)
+	return nil
+}
+
+/*
+	Sends a command to the elevators on the network, commandRepeats times, or
+	until answered returns true for a message received. answered may be nil.
+*/
+func sendCommand(shared *shared, message typedef.ElevatorMessage, answered func(typedef.ElevatorMessage) bool) error {
+	errorChannel := make(chan error, 16)
+	transport, err := shared.config.Transport(errorChannel)
+	if err != nil {
+		return err
+	}
+	nodeConfig, err := shared.config.Node(errorChannel)
+	if err != nil {
+		return err
+	}
+	sendChannel := make(chan typedef.ElevatorMessage, commandRepeats)
+	receiveChannel := make(chan typedef.ElevatorMessage, 10)
+	localIP, handle, err := network.Start(context.Background(), transport, nodeConfig.Network, receiveChannel, sendChannel)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	message.SenderIp = localIP
+	for i := 0; i < commandRepeats; i++ {
+		sendChannel <- message
+		timeout := time.After(commandInterval)
+	wait:
+		for {
+			select {
+			case received := <-receiveChannel:
+				if answered != nil && answered(received) {
+					return nil
+				}
+			case <-timeout:
+				break wait
+			}
+		}
+	}
+	return nil
+}
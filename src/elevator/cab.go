@@ -0,0 +1,93 @@
+package elevator
+
+/*
+	Cancelling cab orders. A cab button pressed twice within DoublePressTime,
+	or held for the long press of the hardware, cancels the cab order of its
+	floor and clears its lamp. The cab order at the origin of destination
+	calls is not cancelled, as the passengers picked up there are waiting
+	for the car.
+	The anti-nuisance cancels the cab orders nobody is going to: when the
+	car has stopped NuisanceStops times in a row without anyone getting on
+	or off, every cab order left is cancelled. Someone gets on or off when
+	the load of the car changes, the obstruction is broken or a door button
+	is pressed while the door is open, so it only works in a car with a load
+	sensor, and is off when Capacity is 0. It is off in the service modes,
+	where the car is driven by hand.
+*/
+
+import (
+	"log"
+	"time"
+	"typedef"
+)
+
+const defaultDoublePressTime = 500 * time.Millisecond
+
+type cabState struct {
+	pressed    [typedef.N_FLOORS]time.Time // When each cab button was last pressed.
+	watching   bool                        // The door is open at a stop the anti-nuisance counts.
+	activity   bool                        // Someone got on or off at the stop.
+	quietStops int                         // The stops in a row where nobody got on or off.
+}
+
+// Whether a cab button is pressed again within DoublePressTime, while its order is set.
+func (elev *elevator) doublePress(floor int) bool {
+	now := time.Now()
+	last := elev.cab.pressed[floor]
+	elev.cab.pressed[floor] = now
+	return elev.state.InternalOrders[floor] && now.Sub(last) < elev.config.DoublePressTime
+}
+
+func (elev *elevator) cancelCab(floor int) {
+	if !elev.state.InternalOrders[floor] || elev.hasPickups(floor) {
+		return
+	}
+	printDebug("Cancelled the cab order at", floor)
+	elev.state.InternalOrders[floor] = false
+	elev.setLight(typedef.BUTTON_COMMAND, floor, false)
+}
+
+func (elev *elevator) hasPickups(floor int) bool {
+	for _, going := range elev.pickups[floor] {
+		if going {
+			return true
+		}
+	}
+	return false
+}
+
+// Called when the door opens at a stop, which the anti-nuisance watches.
+func (elev *elevator) watchStop() {
+	elev.cab.watching = true
+	elev.cab.activity = false
+}
+
+// Called when someone may be getting on or off.
+func (elev *elevator) noticeActivity() {
+	if elev.door.state != doorClosed {
+		elev.cab.activity = true
+	}
+}
+
+// Called when the door closes. Counts the stop, and cancels the cab orders after NuisanceStops quiet ones.
+func (elev *elevator) endStop() {
+	if !elev.cab.watching {
+		return
+	}
+	elev.cab.watching = false
+	if elev.cab.activity || elev.config.NuisanceStops <= 0 || elev.config.Capacity <= 0 || elev.state.Service != typedef.ServiceNormal {
+		elev.cab.quietStops = 0
+		return
+	}
+	elev.cab.quietStops++
+	if elev.cab.quietStops < elev.config.NuisanceStops {
+		return
+	}
+	elev.cab.quietStops = 0
+	for floor, ordered := range elev.state.InternalOrders {
+		if ordered && !elev.hasPickups(floor) {
+			log.Printf("ELEVATOR:\t Nobody got on or off at the last %d stops, cancelling the cab order at floor %d.\n", elev.config.NuisanceStops, floor)
+			elev.cancelCab(floor)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package elevator
+
+/*
+	Destination dispatch. A passenger tells a panel at the origin floor where
+	they are going, and the group chooses the car and gives it the call on
+	the Destination channel. The car gets a cab order at the origin to pick
+	the passenger up, and the destination is registered as a cab order when
+	it stops there, so the passenger never presses a cab button.
+	The destinations waiting to be picked up are in the state, so the group
+	can put the passengers going to the same floor in the same car.
+*/
+
+import (
+	"typedef"
+)
+
+func (elev *elevator) handleDestination(call typedef.DestinationCall) {
+	printDebug("Destination call", call)
+	if !elev.takesButton(typedef.BUTTON_CALL_UP) || call.Origin == call.Destination {
+		return
+	}
+	elev.pickups[call.Origin][call.Destination] = true
+	elev.state.Destinations[call.Destination] = true
+	elev.state.InternalOrders[call.Origin] = true
+	elev.setLight(typedef.BUTTON_COMMAND, call.Origin, true)
+	elev.addOrder(typedef.Order{Floor: call.Origin, ButtonType: typedef.BUTTON_COMMAND, Value: true})
+}
+
+// Registers the destinations of the passengers picked up at the floor as cab orders.
+func (elev *elevator) board(floor int) {
+	for destination, going := range elev.pickups[floor] {
+		if going {
+			printDebug("Boarding for", destination)
+			elev.pickups[floor][destination] = false
+			elev.state.InternalOrders[destination] = true
+			elev.setLight(typedef.BUTTON_COMMAND, destination, true)
+		}
+	}
+	elev.updateDestinations()
+}
+
+// Forgets the passengers waiting to be picked up, when the cab orders are cleared.
+func (elev *elevator) clearPickups() {
+	elev.pickups = [typedef.N_FLOORS][typedef.N_FLOORS]bool{}
+	elev.updateDestinations()
+}
+
+func (elev *elevator) updateDestinations() {
+	elev.state.Destinations = [typedef.N_FLOORS]bool{}
+	for origin := range elev.pickups {
+		for destination, going := range elev.pickups[origin] {
+			elev.state.Destinations[destination] = elev.state.Destinations[destination] || going
+		}
+	}
+}
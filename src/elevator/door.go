@@ -0,0 +1,194 @@
+package elevator
+
+/*
+	The door of the car. It opens when the car stops at a floor, and closes
+	after the dwell time, DoorOpenTime, or DoorOpenTimeAtFloor for an order
+	at the floor the car was waiting at. While it is open:
+	- a hall button at the floor, for the way the car is going, opens it for
+	  the dwell time again, and is served at once.
+	- the door open button opens it for the dwell time again, and the door
+	  close button closes it at once.
+	- the obstruction holds it open. It closes after the dwell time when the
+	  obstruction is gone.
+	A door held open for longer than MaxDoorHoldTime, by the obstruction or
+	the buttons, is nudged: it closes slowly over NudgeTime, and can not be
+	held or opened again until it has closed.
+	In a fire recall the door is kept open at the recall floor until the recall
+	is over, and in independent service until the next cab order. The door
+	buttons and the obstruction do nothing meanwhile.
+	The car does not move while the door is not closed.
+*/
+
+import (
+	"log"
+	"time"
+	"typedef"
+)
+
+const defaultMaxDoorHoldTime = 20 * time.Second
+const defaultNudgeTime = 3 * time.Second
+
+// The states of the door.
+const (
+	doorClosed  = iota
+	doorOpen    // Open for the dwell time.
+	doorHeld    // Held open by the obstruction.
+	doorNudging // Closing after it was held open for too long.
+	doorParked  // Kept open by the fire recall or the independent service.
+)
+
+type door struct {
+	state      int
+	timer      *time.Timer // The end of the dwell time, of the hold time, or of the nudge.
+	openedAt   time.Time
+	obstructed bool
+}
+
+func newDoor() door {
+	d := door{timer: time.NewTimer(time.Hour)}
+	d.timer.Stop()
+	return d
+}
+
+/*
+	Opens the door for the dwell time, or keeps it open for the dwell time if
+	it is already open. It is held if the obstruction is active. A nudging
+	door is not opened again.
+*/
+func (elev *elevator) openDoor(dwell time.Duration) {
+	switch elev.door.state {
+	case doorNudging:
+		return
+	case doorClosed:
+		printDebug("Opening the door at", elev.state.Lastfloor)
+		elev.busy()
+		elev.door.openedAt = time.Now()
+		elev.setLight(typedef.DOOR_LAMP, 0, true)
+		elev.state.SetOpenDoor(true)
+	}
+	if elev.door.obstructed {
+		elev.holdDoor()
+		return
+	}
+	if time.Since(elev.door.openedAt) >= elev.config.MaxDoorHoldTime {
+		elev.nudgeDoor()
+		return
+	}
+	elev.door.state = doorOpen
+	elev.door.timer.Reset(dwell)
+}
+
+// Holds the door open until the obstruction is gone, or it has been open for MaxDoorHoldTime.
+func (elev *elevator) holdDoor() {
+	remaining := elev.config.MaxDoorHoldTime - time.Since(elev.door.openedAt)
+	if remaining <= 0 {
+		elev.nudgeDoor()
+		return
+	}
+	elev.door.state = doorHeld
+	elev.door.timer.Reset(remaining)
+}
+
+func (elev *elevator) nudgeDoor() {
+	log.Printf("ELEVATOR:\t The door has been open for %v, nudging it closed.\n", time.Since(elev.door.openedAt).Round(time.Second))
+	elev.door.state = doorNudging
+	elev.door.timer.Reset(elev.config.NudgeTime)
+}
+
+// Opens the door, and keeps it open until releaseDoor.
+func (elev *elevator) parkDoor() {
+	if elev.door.state == doorClosed {
+		elev.setLight(typedef.DOOR_LAMP, 0, true)
+		elev.state.SetOpenDoor(true)
+	}
+	elev.door.state = doorParked
+	elev.door.timer.Stop()
+}
+
+// Lets a parked door close after the dwell time.
+func (elev *elevator) releaseDoor() {
+	if elev.door.state != doorParked {
+		return
+	}
+	elev.door.state, elev.door.openedAt = doorOpen, time.Now()
+	elev.openDoor(elev.config.DoorOpenTime)
+}
+
+/*
+	Closes the door, and starts the car towards its next order. If its only
+	orders are at this floor, they came while the door was closing, and it is
+	opened for them again.
+*/
+func (elev *elevator) closeDoor() {
+	printDebug("Closing the door at", elev.state.Lastfloor)
+	elev.door.state = doorClosed
+	elev.door.timer.Stop()
+	elev.state.SetOpenDoor(false)
+	elev.setLight(typedef.DOOR_LAMP, 0, false)
+	elev.endStop()
+	if elev.stopped || elev.state.OutOfService {
+		return
+	}
+	if elev.state.NextDirection() == typedef.DIR_STOP && elev.state.HaveOrdersAtCurrentFloor() {
+		elev.stopAtFloor(elev.config.DoorOpenTimeAtFloor)
+		return
+	}
+	elev.start()
+}
+
+func (elev *elevator) handleDoorTimeout() {
+	printDebug("Door timeout", elev.state.Lastfloor)
+	switch elev.door.state {
+	case doorOpen, doorNudging:
+		elev.closeDoor()
+	case doorHeld:
+		elev.nudgeDoor()
+	}
+}
+
+func (elev *elevator) handleObstruction(obstructed bool) {
+	printDebug("Obstruction", obstructed)
+	elev.door.obstructed = obstructed
+	if obstructed {
+		elev.noticeActivity()
+	}
+	switch {
+	case obstructed && elev.door.state == doorOpen:
+		elev.holdDoor()
+	case !obstructed && elev.door.state == doorHeld:
+		elev.openDoor(elev.config.DoorOpenTime)
+	}
+}
+
+// The door open button opens the door of a car waiting at a floor. The door close button closes an open door at once.
+func (elev *elevator) handleDoorButton(buttonType int) {
+	elev.noticeActivity()
+	switch {
+	case buttonType == typedef.BUTTON_DOOR_CLOSE && elev.door.state == doorOpen:
+		elev.closeDoor()
+	case buttonType == typedef.BUTTON_DOOR_OPEN && elev.door.state == doorOpen:
+		elev.openDoor(elev.config.DoorOpenTime)
+	case buttonType == typedef.BUTTON_DOOR_OPEN && elev.door.state == doorClosed && !elev.state.Moving && !elev.stopped:
+		elev.openDoor(elev.config.DoorOpenTime)
+	}
+}
+
+/*
+	Serves a hall call pressed at the floor of the open door, for the way the
+	car is going, by keeping the door open. Returns false if it is not one,
+	or the car is full.
+*/
+func (elev *elevator) reopenForHallCall(order typedef.Order) bool {
+	if (elev.door.state != doorOpen && elev.door.state != doorHeld) || order.Floor != elev.state.Lastfloor {
+		return false
+	}
+	direction := elev.state.Direction
+	if (direction == typedef.DIR_UP && order.ButtonType != typedef.BUTTON_CALL_UP) ||
+		(direction == typedef.DIR_DOWN && order.ButtonType != typedef.BUTTON_CALL_DOWN) || elev.state.Passes(order.ButtonType) {
+		return false
+	}
+	printDebug("Reopening the door for", order)
+	elev.reportServed(order)
+	elev.openDoor(elev.config.DoorOpenTime)
+	return true
+}
@@ -0,0 +1,513 @@
+package elevator
+
+/*
+	This module controls one elevator car. It is an event loop that receives
+	button and floor events from the hardware module, keeps the ElevatorState
+	and decides where the car should go.
+	In a group of elevators the hall calls are passed on the HallCall channel to
+	the group module, which decides which elevator should serve them and hands
+	them back on the Assign channel. Served hall calls are reported on the Done
+	channel, and the group module owns the hall call lamps.
+	Without a group (HallCall is nil) the car serves its own hall calls.
+	The cab orders and the service mode are written to the state file when
+	the elevator is stopped, and read again when it is started, so no
+	passenger is forgotten on a restart. The car resumes the cab orders at
+	the first floor event.
+	The door is opened, held and closed as described in door.go, and the car
+	does not move until it is closed. A car without orders parks as described
+	in parking.go, and the fire recall is described in recall.go. A car can be
+	taken out of the group by the service modes in service.go. The calls of
+	the destination dispatch panels are served as in destination.go, and a
+	full car passes hall calls by as in load.go. The cab orders can be
+	cancelled as in cab.go.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hardware"
+	"io/fs"
+	"lifecycle"
+	"log"
+	"os"
+	"parking"
+	"time"
+	"typedef"
+)
+
+const debug = false
+
+const defaultDoorOpenTime = 3 * time.Second
+const defaultDoorOpenTimeAtFloor = 5 * time.Second
+
+// How to run the elevator. The zero values are the defaults.
+type Config struct {
+	DoorOpenTime        time.Duration // When arriving at an ordered floor.
+	DoorOpenTimeAtFloor time.Duration // When ordered to the floor the car is waiting at.
+	MaxDoorHoldTime     time.Duration // How long the door may be held open before it is nudged closed.
+	NudgeTime           time.Duration // How long a nudged door takes to close.
+	StateFile           string        // Where the cab orders and the service mode are kept while the elevator is stopped, "" for nowhere.
+	RecallFloor         int           // The floor the car goes to in a fire recall.
+	Capacity            int           // The rated load of the car in kg, 0 if it has no load sensor.
+	FullLoad            int           // The load in percent of Capacity above which the car is full. 0 is defaultFullLoad.
+	DoublePressTime     time.Duration // How soon a cab button pressed again cancels its order. 0 is defaultDoublePressTime.
+	NuisanceStops       int           // The stops in a row where nobody gets on or off before the cab orders are cancelled. 0 is never, and so is a Capacity of 0.
+	Parking             parking.Policy
+	PeakIdleTime        time.Duration // How long the car waits before it parks at the floor the group plans in a traffic peak, when Parking has no idle time. 0 is never.
+}
+
+// The channels the elevator talks to the other modules on.
+type Channels struct {
+	Button       <-chan hardware.ButtonEvent
+	Light        chan<- hardware.LightEvent
+	Motor        chan<- hardware.MotorEvent
+	Floor        <-chan hardware.FloorEvent
+	HallCall     chan<- typedef.Order           // Hall buttons pressed, nil to serve hall calls locally.
+	Assign       <-chan typedef.Order           // Hall calls given to (Value true) or taken from this car.
+	Done         chan<- typedef.Order           // Hall calls served by this car.
+	State        chan typedef.ElevatorState     // Buffered with size 1, always holds the latest state.
+	Served       chan<- typedef.Order           // Every order served by this car, cab orders too. May be nil.
+	Fault        <-chan hardware.FaultEvent     // Motor faults from the hardware. May be nil.
+	Park         <-chan int                     // The park floor planned by the group, -1 for none. nil parks by the policy alone.
+	RecallSwitch chan<- bool                    // The recall key switch of this car turned, to the group. nil recalls this car only.
+	Recall       <-chan bool                    // The fire recall turned on or off by the group. May be nil.
+	Service      <-chan int                     // The service mode set by a command. May be nil.
+	Destination  <-chan typedef.DestinationCall // The destination calls given to this car by the group. May be nil.
+	Load         <-chan int                     // The load of the car in kg, from the load sensor. May be nil.
+}
+
+type elevator struct {
+	state     typedef.ElevatorState
+	channels  Channels
+	door      door
+	park      parkState
+	recalled  bool // The car is in a fire recall.
+	stopped   bool // The stop button is active.
+	restored  bool // Cab orders were read from the state file, and are resumed at the first floor event.
+	stopFloor int  // The floor the car stops at, last sent to the hardware.
+	done      <-chan struct{}
+	config    Config
+	pickups   [typedef.N_FLOORS][typedef.N_FLOORS]bool // The destinations of the passengers to pick up at each floor.
+	cab       cabState
+}
+
+// The contents of the state file.
+type savedState struct {
+	InternalOrders [typedef.N_FLOORS]bool
+	Service        int
+	Pickups        [typedef.N_FLOORS][typedef.N_FLOORS]bool
+}
+
+/*
+	Starts the elevator as a goroutine for good. The hardware module must be
+	initialized with the same channels.
+*/
+func Init(channels Channels) {
+	Start(context.Background(), channels, Config{})
+}
+
+/*
+	Starts the elevator as a goroutine, which runs until the context is done or
+	the handle is closed.
+*/
+func Start(ctx context.Context, channels Channels, config Config) *lifecycle.Handle {
+	if config.DoorOpenTime == 0 {
+		config.DoorOpenTime = defaultDoorOpenTime
+	}
+	if config.DoorOpenTimeAtFloor == 0 {
+		config.DoorOpenTimeAtFloor = defaultDoorOpenTimeAtFloor
+	}
+	if config.MaxDoorHoldTime == 0 {
+		config.MaxDoorHoldTime = defaultMaxDoorHoldTime
+	}
+	if config.NudgeTime == 0 {
+		config.NudgeTime = defaultNudgeTime
+	}
+	if config.FullLoad == 0 {
+		config.FullLoad = defaultFullLoad
+	}
+	if config.DoublePressTime == 0 {
+		config.DoublePressTime = defaultDoublePressTime
+	}
+	handle, ctx := lifecycle.New(ctx)
+	elev := &elevator{channels: channels, door: newDoor(), park: newParkState(), done: ctx.Done(), config: config}
+	if config.StateFile != "" {
+		elev.restore(config.StateFile)
+		handle.Cleanup(func() { elev.save(config.StateFile) })
+	}
+	handle.Go(func() { elev.run(ctx) })
+	return handle
+}
+
+// ----------------------  WAIT FOR EVENTS! -------------------------
+func (elev *elevator) run(ctx context.Context) {
+	for floor, ordered := range elev.state.InternalOrders {
+		if ordered {
+			elev.setLight(typedef.BUTTON_COMMAND, floor, true)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			elev.door.timer.Stop()
+			elev.park.timer.Stop()
+			return
+		case buttonEvent := <-elev.channels.Button:
+			elev.handleButton(buttonEvent)
+		case order := <-elev.channels.Assign:
+			elev.handleAssign(order)
+		case floorEvent := <-elev.channels.Floor:
+			elev.handleFloor(floorEvent)
+		case faultEvent := <-elev.channels.Fault:
+			elev.handleFault(faultEvent)
+		case <-elev.door.timer.C:
+			elev.handleDoorTimeout()
+		case floor := <-elev.channels.Park:
+			elev.handlePark(floor)
+		case <-elev.park.timer.C:
+			elev.parkCar()
+		case on := <-elev.channels.Recall:
+			elev.handleRecall(on)
+		case mode := <-elev.channels.Service:
+			elev.handleService(mode)
+		case call := <-elev.channels.Destination:
+			elev.handleDestination(call)
+		case kg := <-elev.channels.Load:
+			elev.handleLoad(kg)
+		}
+		elev.updateStopFloor()
+		if debug {
+			elev.state.PrintState()
+		}
+		elev.publishState()
+	}
+}
+
+func (elev *elevator) handleButton(buttonEvent hardware.ButtonEvent) {
+	bType := buttonEvent.ButtonType
+	order := typedef.Order{Floor: buttonEvent.Floor, ButtonType: bType, Value: true}
+	if !elev.takesButton(bType) {
+		printDebug("Ignored in the fire recall or the service mode", order)
+		return
+	}
+	switch bType {
+	case typedef.BUTTON_COMMAND:
+		if !buttonEvent.Value || elev.doublePress(order.Floor) {
+			elev.cancelCab(order.Floor)
+			return
+		}
+		printDebug("New cab order", order)
+		if elev.state.Service == typedef.ServiceIndependent {
+			elev.handleIndependentCab(order.Floor)
+			return
+		}
+		elev.state.InternalOrders[order.Floor] = true
+		elev.setLight(bType, order.Floor, true)
+		elev.addOrder(order)
+	case typedef.BUTTON_CALL_UP, typedef.BUTTON_CALL_DOWN:
+		printDebug("New hall order", order)
+		if elev.reopenForHallCall(order) {
+			return
+		}
+		if elev.channels.HallCall != nil {
+			elev.sendOrder(elev.channels.HallCall, order)
+			return
+		}
+		elev.state.ExternalOrders[order.Floor][bType] = true
+		elev.setLight(bType, order.Floor, true)
+		elev.addOrder(order)
+	case typedef.BUTTON_STOP:
+		printDebug("Received stop button event", buttonEvent)
+		elev.stopped = buttonEvent.Value
+		elev.setLight(typedef.BUTTON_STOP, 0, buttonEvent.Value)
+		if elev.stopped {
+			elev.setMotor(typedef.DIR_STOP)
+			elev.state.SetMoving(false)
+		} else if elev.state.Direction != typedef.DIR_STOP && elev.door.state == doorClosed && !elev.state.OutOfService {
+			elev.setMotor(elev.state.Direction)
+			elev.state.SetMoving(true)
+		} else if elev.recalled {
+			elev.recallFrom(elev.state.Lastfloor)
+		}
+	case typedef.OBSTRUCTION_SENS:
+		elev.handleObstruction(buttonEvent.Value)
+	case typedef.BUTTON_DOOR_OPEN, typedef.BUTTON_DOOR_CLOSE:
+		printDebug("Door button", bType)
+		elev.handleDoorButton(bType)
+	case typedef.RECALL_SWITCH:
+		elev.handleRecallSwitch(buttonEvent.Value)
+	}
+}
+
+func (elev *elevator) handleAssign(order typedef.Order) {
+	printDebug("Hall order assigned", order)
+	if (elev.recalled || elev.state.Service != typedef.ServiceNormal) && order.Value {
+		return
+	}
+	elev.state.ExternalOrders[order.Floor][order.ButtonType] = order.Value
+	if order.Value {
+		elev.addOrder(order)
+	}
+}
+
+func (elev *elevator) handleFloor(floorEvent hardware.FloorEvent) {
+	printDebug("At floor", floorEvent.Floor)
+	elev.state.SetLastFloor(floorEvent.Floor)
+	// Initialization between floors.
+	if elev.state.Direction == typedef.DIR_STOP {
+		elev.setMotor(typedef.DIR_STOP)
+		elev.state.SetMoving(false)
+		if !elev.state.HaveOrders() {
+			elev.start()
+		}
+	}
+	if elev.recalled {
+		elev.recallFrom(floorEvent.Floor)
+	} else if elev.park.moving {
+		elev.parkAtFloor(floorEvent.Floor)
+	} else if elev.state.Moving && elev.state.ShouldStop() {
+		elev.stopAtFloor(elev.config.DoorOpenTime)
+	} else if elev.state.Moving && elev.state.NextDirection() != elev.state.Direction {
+		// The orders are all behind the car, which was parking or had the ones ahead taken away.
+		elev.setMotor(typedef.DIR_STOP)
+		elev.state.SetMoving(false)
+		elev.start()
+	}
+	if elev.restored {
+		elev.restored = false
+		for floor, ordered := range elev.state.InternalOrders {
+			if ordered {
+				elev.addOrder(typedef.Order{Floor: floor, ButtonType: typedef.BUTTON_COMMAND, Value: true})
+			}
+		}
+	}
+}
+
+/*
+	The hardware gives up on the motor when it has failed too many times. The
+	car is then out of service: it stays where it is and starts for no order.
+	The group sees it in the state and gives its hall calls to the others.
+*/
+func (elev *elevator) handleFault(faultEvent hardware.FaultEvent) {
+	printDebug("Motor fault", faultEvent.Err)
+	if !faultEvent.OutOfService {
+		return
+	}
+	log.Println("ELEVATOR:\t The motor has failed, the elevator is out of service.")
+	elev.state.SetOutOfService(true)
+	elev.state.SetMoving(false)
+	elev.state.SetDirection(typedef.DIR_STOP)
+}
+
+/*
+	Called when the car has got a new order. An idle car starts towards it, and
+	an order at the floor the car is waiting at opens the door. An order at the
+	floor of a nudged door waits until the door has closed.
+*/
+func (elev *elevator) addOrder(order typedef.Order) {
+	elev.busy()
+	if elev.state.Moving || elev.stopped || elev.state.OutOfService || elev.recalled {
+		return
+	}
+	if order.Floor == elev.state.Lastfloor {
+		if elev.door.state != doorNudging {
+			elev.stopAtFloor(elev.config.DoorOpenTimeAtFloor)
+		}
+	} else if elev.door.state == doorClosed {
+		elev.start()
+	}
+}
+
+/*
+	Starts the car in the direction of the next order, if there is any. It
+	does not start while the door is not closed. A car in independent service
+	without orders waits with the door open.
+*/
+func (elev *elevator) start() {
+	if elev.door.state != doorClosed {
+		printDebug("The door is not closed, staying at floor", elev.state.Lastfloor)
+		return
+	}
+	direction := elev.state.NextDirection()
+	elev.state.SetDirection(direction)
+	if direction == typedef.DIR_STOP && elev.state.Service == typedef.ServiceIndependent {
+		printDebug("Independent service, waiting at floor", elev.state.Lastfloor)
+		elev.parkDoor()
+		return
+	} else if direction == typedef.DIR_STOP {
+		printDebug("No orders, staying at floor", elev.state.Lastfloor)
+		elev.idle()
+		return
+	}
+	elev.state.SetMoving(true)
+	elev.setMotor(direction)
+}
+
+// Stops the car, opens the door and clears the orders at this floor.
+func (elev *elevator) stopAtFloor(doorTime time.Duration) {
+	elev.setMotor(typedef.DIR_STOP)
+	elev.state.SetMoving(false)
+	elev.clearOrdersAtFloor(elev.state.Lastfloor)
+	elev.openDoor(doorTime)
+	elev.watchStop()
+	if elev.state.Service == typedef.ServiceIndependent {
+		elev.parkDoor()
+	}
+}
+
+/*
+	Clears the cab order and the hall call in the direction of travel. The hall
+	call in the other direction is also cleared if the car is turning around.
+	The passengers picked up here get their destinations first. A full car
+	leaves the hall calls it passes.
+*/
+func (elev *elevator) clearOrdersAtFloor(floor int) {
+	elev.board(floor)
+	if elev.state.InternalOrders[floor] {
+		elev.state.InternalOrders[floor] = false
+		elev.reportServed(typedef.Order{Floor: floor, ButtonType: typedef.BUTTON_COMMAND})
+	}
+	elev.setLight(typedef.BUTTON_COMMAND, floor, false)
+
+	direction := elev.state.Direction
+	if direction != typedef.DIR_DOWN {
+		elev.clearHallOrder(floor, typedef.BUTTON_CALL_UP)
+	}
+	if direction != typedef.DIR_UP {
+		elev.clearHallOrder(floor, typedef.BUTTON_CALL_DOWN)
+	}
+	// Check if we are turning around.
+	if direction == typedef.DIR_UP && !elev.state.HaveOrderAbove() {
+		elev.clearHallOrder(floor, typedef.BUTTON_CALL_DOWN)
+	} else if direction == typedef.DIR_DOWN && !elev.state.HaveOrderBelow() {
+		elev.clearHallOrder(floor, typedef.BUTTON_CALL_UP)
+	}
+}
+
+func (elev *elevator) clearHallOrder(floor, buttonType int) {
+	if !elev.state.ExternalOrders[floor][buttonType] || elev.state.Passes(buttonType) {
+		return
+	}
+	elev.state.ExternalOrders[floor][buttonType] = false
+	elev.reportServed(typedef.Order{Floor: floor, ButtonType: buttonType})
+	if elev.channels.HallCall == nil {
+		elev.setLight(buttonType, floor, false)
+	} else {
+		elev.sendOrder(elev.channels.Done, typedef.Order{Floor: floor, ButtonType: buttonType})
+	}
+}
+
+func (elev *elevator) reportServed(order typedef.Order) {
+	if elev.channels.Served != nil {
+		elev.sendOrder(elev.channels.Served, order)
+	}
+}
+
+// The sends to the other modules give up when the elevator is stopped, as they may be stopped too.
+func (elev *elevator) setLight(lightType, floor int, value bool) {
+	select {
+	case elev.channels.Light <- hardware.LightEvent{LightType: lightType, Floor: floor, Value: value}:
+	case <-elev.done:
+	}
+}
+
+/*
+	The floor the car will stop at is sent with the direction, so the hardware
+	can slow down for it. The motor is never started while the door is not
+	closed.
+*/
+func (elev *elevator) setMotor(direction int) {
+	if direction != typedef.DIR_STOP && elev.door.state != doorClosed {
+		log.Println("ELEVATOR:\t Refusing to start the motor while the door is not closed.")
+		return
+	}
+	elev.stopFloor = -1
+	if direction != typedef.DIR_STOP {
+		elev.stopFloor = elev.nextStop()
+	}
+	select {
+	case elev.channels.Motor <- hardware.MotorEvent{MotorDirection: direction, StopFloor: elev.stopFloor}:
+	case <-elev.done:
+	}
+}
+
+// Tells the hardware when the floor the moving car stops at has changed with the orders.
+func (elev *elevator) updateStopFloor() {
+	if elev.state.Moving && elev.nextStop() != elev.stopFloor {
+		elev.setMotor(elev.state.Direction)
+	}
+}
+
+func (elev *elevator) sendOrder(channel chan<- typedef.Order, order typedef.Order) {
+	select {
+	case channel <- order:
+	case <-elev.done:
+	}
+}
+
+// Reads the cab orders and the service mode from the state file. A missing file means there are none.
+func (elev *elevator) restore(stateFile string) {
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	} else if err != nil {
+		log.Println("ELEVATOR:\t Unable to read the state file:", err)
+		return
+	}
+	var saved savedState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Println("ELEVATOR:\t Unable to read the state file:", err)
+		return
+	}
+	for floor, ordered := range saved.InternalOrders {
+		if ordered {
+			elev.state.InternalOrders[floor] = true
+			elev.restored = true
+		}
+	}
+	elev.pickups = saved.Pickups
+	elev.updateDestinations()
+	if saved.Service != typedef.ServiceNormal {
+		log.Printf("ELEVATOR:\t The elevator is still in %s service.\n", typedef.ServiceName(saved.Service))
+		elev.state.Service = saved.Service
+	}
+}
+
+// Writes the cab orders and the service mode to the state file. It is written to a temporary file first, so it is never half written.
+func (elev *elevator) save(stateFile string) {
+	data, err := json.Marshal(savedState{InternalOrders: elev.state.InternalOrders, Service: elev.state.Service, Pickups: elev.pickups})
+	if err == nil {
+		err = os.WriteFile(stateFile+".tmp", data, 0644)
+	}
+	if err == nil {
+		err = os.Rename(stateFile+".tmp", stateFile)
+	}
+	if err != nil {
+		log.Println("ELEVATOR:\t Unable to write the state file:", err)
+	}
+}
+
+// Replaces the state on the state channel with the current one.
+func (elev *elevator) publishState() {
+	if elev.channels.State == nil {
+		return
+	}
+	select {
+	case <-elev.channels.State:
+	default:
+	}
+	select {
+	case elev.channels.State <- elev.state:
+	default:
+	}
+}
+
+/*
+	Helper function that prints to console if the program is in debug mode.
+*/
+func printDebug(s string, v interface{}) {
+	if debug {
+		log.Println("ELEVATOR:\t", s, v)
+	}
+}
@@ -0,0 +1,39 @@
+package elevator
+
+/*
+	The load of the car. The hardware reads the load sensor, and sends the load
+	in kg on the Load channel when it changes. The state has the load in
+	percent of Config.Capacity, and a car loaded above Config.FullLoad percent
+	is full: nobody could get on, so it passes by the hall calls in the way it
+	is going, see typedef.ElevatorState.Passes. The cab orders are served as
+	usual. In a group the master gives the hall calls passed by to the other
+	cars, and without a group the car takes them when it has turned.
+*/
+
+import (
+	"log"
+)
+
+const defaultFullLoad = 80
+
+func (elev *elevator) handleLoad(kg int) {
+	if elev.config.Capacity <= 0 {
+		return
+	}
+	elev.noticeActivity()
+	elev.state.Load = kg * 100 / elev.config.Capacity
+	full := elev.state.Load > elev.config.FullLoad
+	if full == elev.state.Full {
+		return
+	}
+	elev.state.Full = full
+	if full {
+		log.Printf("ELEVATOR:\t The car is full, %d%% load.\n", elev.state.Load)
+		return
+	}
+	log.Printf("ELEVATOR:\t The car is no longer full, %d%% load.\n", elev.state.Load)
+	// The passengers waiting at the open door can get on now.
+	if !elev.state.Moving && elev.door.state != doorClosed && !elev.recalled {
+		elev.clearOrdersAtFloor(elev.state.Lastfloor)
+	}
+}
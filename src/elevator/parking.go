@@ -0,0 +1,131 @@
+package elevator
+
+/*
+	Parking of the idle car. When the car has had no orders for the idle time
+	of the parking policy it drives to its park floor, and waits there with
+	the door closed. In a group the park floor is planned by the group module
+	and given on the Park channel, so the cars park in different zones. When
+	the policy has no idle time, the group only plans park floors in the
+	traffic peaks, and the car waits the peak idle time before it parks.
+	Without a group the car parks at the first park floor of the policy.
+	A new order interrupts the parking at once: the car goes on towards the
+	order if it is ahead, and turns at the next floor if it is not.
+*/
+
+import (
+	"time"
+	"typedef"
+)
+
+type parkState struct {
+	timer  *time.Timer // Runs while the car is idle, until it parks.
+	since  time.Time   // When the car became idle, zero while it is not.
+	floor  int         // The park floor from the group, -1 for none.
+	moving bool        // The car is driving to its park floor.
+}
+
+func newParkState() parkState {
+	p := parkState{timer: time.NewTimer(time.Hour), floor: -1}
+	p.timer.Stop()
+	return p
+}
+
+// Called when the car has nothing to do. It parks when it has been idle for the idle time.
+func (elev *elevator) idle() {
+	if !elev.park.since.IsZero() || elev.idleTime() == 0 || elev.recalled || elev.state.Service != typedef.ServiceNormal {
+		return
+	}
+	elev.park.since = time.Now()
+	elev.park.timer.Reset(elev.idleTime())
+}
+
+// How long the car waits without orders before it parks, 0 if it does not.
+func (elev *elevator) idleTime() time.Duration {
+	if elev.config.Parking.IdleTime == 0 && elev.channels.Park != nil {
+		return elev.config.PeakIdleTime
+	}
+	return elev.config.Parking.IdleTime
+}
+
+// Called when the car has got an order. A parking car drives on for the order instead.
+func (elev *elevator) busy() {
+	elev.park.since = time.Time{}
+	elev.park.timer.Stop()
+	if elev.park.moving {
+		printDebug("Parking interrupted at", elev.state.Lastfloor)
+		elev.park.moving = false
+	}
+}
+
+// The floor this car parks at, -1 if it does not.
+func (elev *elevator) parkFloor() int {
+	if elev.channels.Park != nil {
+		return elev.park.floor
+	}
+	plan := elev.config.Parking.Plan(time.Now(), map[string]int{"": elev.state.Lastfloor})
+	if floor, ok := plan[""]; ok {
+		return floor
+	}
+	return -1
+}
+
+// Drives the idle car to its park floor.
+func (elev *elevator) parkCar() {
+	if elev.state.HaveOrders() || elev.state.Moving || elev.door.state != doorClosed || elev.stopped || elev.state.OutOfService || elev.recalled {
+		return
+	}
+	floor := elev.parkFloor()
+	if floor == -1 || floor == elev.state.Lastfloor {
+		return
+	}
+	printDebug("Parking at", floor)
+	direction := typedef.DIR_UP
+	if floor < elev.state.Lastfloor {
+		direction = typedef.DIR_DOWN
+	}
+	elev.park.moving = true
+	elev.drive(direction)
+}
+
+// Drives the car without an order, to park or in the fire recall.
+func (elev *elevator) drive(direction int) {
+	elev.state.SetDirection(direction)
+	elev.state.SetMoving(true)
+	elev.setMotor(direction)
+}
+
+/*
+	Called at every floor while the car drives to its park floor. It stops at
+	the park floor without opening the door, or where it is if the park floor
+	has been moved behind it.
+*/
+func (elev *elevator) parkAtFloor(floor int) {
+	target := elev.parkFloor()
+	if target != -1 && target != floor && (target > floor) == (elev.state.Direction == typedef.DIR_UP) {
+		return
+	}
+	printDebug("Parked at", floor)
+	elev.park.moving = false
+	elev.setMotor(typedef.DIR_STOP)
+	elev.state.SetMoving(false)
+	elev.state.SetDirection(typedef.DIR_STOP)
+}
+
+// The floor the moving car stops at, the recall floor in a fire recall and its park floor if it is parking.
+func (elev *elevator) nextStop() int {
+	if elev.recalled {
+		return elev.config.RecallFloor
+	}
+	if floor := elev.parkFloor(); elev.park.moving && floor != -1 {
+		return floor
+	}
+	return elev.state.NextStop()
+}
+
+// A new park floor from the group. A car which has been idle for the idle time moves to it at once.
+func (elev *elevator) handlePark(floor int) {
+	elev.park.floor = floor
+	if !elev.park.since.IsZero() && time.Since(elev.park.since) >= elev.idleTime() {
+		elev.parkCar()
+	}
+}
@@ -0,0 +1,94 @@
+package elevator
+
+/*
+	The fire recall. When it is turned on every order of the car is cancelled,
+	and the car drives nonstop to the recall floor, turning at the next floor
+	if it is going the other way. There it opens the door and waits until the
+	recall is turned off. The buttons in the car and in the halls are ignored
+	meanwhile.
+	In a group the recall is turned on and off by the group module, on the
+	Recall channel, and the key switch of the car is passed on to the group
+	on the RecallSwitch channel. Without a group the key switch recalls this
+	car only.
+*/
+
+import (
+	"log"
+	"typedef"
+)
+
+// The fire recall key switch of this car has been turned.
+func (elev *elevator) handleRecallSwitch(on bool) {
+	if elev.channels.RecallSwitch == nil {
+		elev.handleRecall(on)
+		return
+	}
+	select {
+	case elev.channels.RecallSwitch <- on:
+	case <-elev.done:
+	}
+}
+
+func (elev *elevator) handleRecall(on bool) {
+	if on == elev.recalled {
+		return
+	}
+	elev.recalled = on
+	if !on {
+		log.Println("ELEVATOR:\t The fire recall is over.")
+		elev.releaseDoor()
+		return
+	}
+	log.Printf("ELEVATOR:\t Fire recall, going to floor %d.\n", elev.config.RecallFloor)
+	elev.busy()
+	elev.clearPickups()
+	for floor := range elev.state.InternalOrders {
+		elev.state.InternalOrders[floor] = false
+		elev.setLight(typedef.BUTTON_COMMAND, floor, false)
+		for button := range elev.state.ExternalOrders[floor] {
+			elev.state.ExternalOrders[floor][button] = false
+			if elev.channels.HallCall == nil {
+				elev.setLight(button, floor, false)
+			}
+		}
+	}
+	if !elev.state.Moving {
+		elev.recallFrom(elev.state.Lastfloor)
+	}
+}
+
+/*
+	Called at every floor while the car is recalled, and when the recall is
+	turned on at a floor. The car parks with the door open at the recall
+	floor, and is driven towards it from the others.
+*/
+func (elev *elevator) recallFrom(floor int) {
+	if elev.stopped || elev.state.OutOfService {
+		return
+	}
+	target := elev.config.RecallFloor
+	if floor == target {
+		if elev.state.Moving {
+			elev.setMotor(typedef.DIR_STOP)
+			elev.state.SetMoving(false)
+		}
+		elev.state.SetDirection(typedef.DIR_STOP)
+		elev.parkDoor()
+		return
+	}
+	direction := typedef.DIR_UP
+	if target < floor {
+		direction = typedef.DIR_DOWN
+	}
+	if elev.state.Moving && elev.state.Direction == direction {
+		return
+	}
+	if elev.state.Moving {
+		elev.setMotor(typedef.DIR_STOP)
+		elev.state.SetMoving(false)
+	}
+	if elev.door.state != doorClosed {
+		elev.closeDoor()
+	}
+	elev.drive(direction)
+}
@@ -0,0 +1,88 @@
+package elevator
+
+/*
+	The service modes, which take the car out of the group for maintenance
+	without powering it off:
+		- maintenance, the car serves no orders, and stops at the next floor.
+		- inspection, the car serves its cab orders only.
+		- independent, the car is reserved, for example to move furniture. It
+		  waits at a floor with the door open until a cab button is pressed,
+		  goes to that floor only, and waits there again.
+	In all of them the hall buttons are ignored and the hall calls of the car
+	are cleared, so the group gives them to the others. The car does not park.
+	The mode is in the state, so the others see it, and is set on the Service
+	channel. It is written to the state file, so the car is still out of the
+	group after a restart.
+*/
+
+import (
+	"log"
+	"typedef"
+)
+
+func (elev *elevator) handleService(mode int) {
+	if mode == elev.state.Service {
+		return
+	}
+	log.Printf("ELEVATOR:\t The elevator is in %s service.\n", typedef.ServiceName(mode))
+	if elev.state.Service == typedef.ServiceIndependent && !elev.recalled {
+		elev.releaseDoor()
+	}
+	elev.state.Service = mode
+	if mode != typedef.ServiceNormal {
+		elev.busy()
+		for floor := range elev.state.ExternalOrders {
+			for button := range elev.state.ExternalOrders[floor] {
+				elev.state.ExternalOrders[floor][button] = false
+				if elev.channels.HallCall == nil {
+					elev.setLight(button, floor, false)
+				}
+			}
+		}
+	}
+	if mode == typedef.ServiceMaintenance || mode == typedef.ServiceIndependent {
+		elev.clearPickups()
+		for floor := range elev.state.InternalOrders {
+			elev.state.InternalOrders[floor] = false
+			elev.setLight(typedef.BUTTON_COMMAND, floor, false)
+		}
+	}
+	if elev.config.StateFile != "" {
+		elev.save(elev.config.StateFile)
+	}
+	// A moving car stops or turns at the next floor, and a car in independent service waits there.
+	if mode == typedef.ServiceIndependent && (elev.door.state == doorOpen || elev.door.state == doorHeld) {
+		elev.parkDoor()
+	} else if !elev.state.Moving && !elev.stopped && !elev.state.OutOfService && !elev.recalled {
+		elev.start()
+	}
+}
+
+// Whether a button press is taken in the service mode and the fire recall.
+func (elev *elevator) takesButton(buttonType int) bool {
+	switch buttonType {
+	case typedef.BUTTON_CALL_UP, typedef.BUTTON_CALL_DOWN:
+		return !elev.recalled && elev.state.Service == typedef.ServiceNormal
+	case typedef.BUTTON_COMMAND:
+		return !elev.recalled && elev.state.Service != typedef.ServiceMaintenance
+	}
+	return true
+}
+
+/*
+	A cab button pressed in independent service. A car waiting at a floor
+	closes the door and goes to the floor, the other presses are ignored.
+*/
+func (elev *elevator) handleIndependentCab(floor int) {
+	if elev.state.Moving || elev.state.HaveOrders() || floor == elev.state.Lastfloor {
+		return
+	}
+	printDebug("Independent service to", floor)
+	elev.state.InternalOrders[floor] = true
+	elev.setLight(typedef.BUTTON_COMMAND, floor, true)
+	if elev.door.state == doorClosed {
+		elev.start()
+	} else {
+		elev.closeDoor()
+	}
+}
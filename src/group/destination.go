@@ -0,0 +1,138 @@
+package group
+
+/*
+	Destination dispatch, see destination.go in the elevator module. The
+	panels send an EventDestinationCall, which the master answers with an
+	EventDestinationAssigned telling the car chosen to take it. The car gets
+	the call from its group on the Destination channel, and answers with an
+	EventDestinationConfirmed, which tells the panel which car to take. A call
+	is not a hall call and has no lamp, the car keeps it as cab orders.
+	The master keeps the calls it has dispatched until the car has picked the
+	passenger up. A panel sends a call again until a car confirms it, so the
+	master answers a call it knows with the car it chose before. A call
+	nobody confirms is sent again, and one held by a car which dies or takes
+	no hall calls before the pickup is given to another car. A new master
+	does not know the calls of the old one, the cars keep them.
+*/
+
+import (
+	"costFunction"
+	"log"
+	"time"
+	"typedef"
+)
+
+const confirmTimeout = 300 * time.Millisecond // How long the master waits for the car to confirm a call.
+const callMemory = 10 * time.Second           // How long the master knows a call after the pickup, so a late retry is not dispatched again.
+
+// A destination call dispatched by the master.
+type dispatch struct {
+	car         string
+	sentAt      time.Time
+	confirmedAt time.Time // Zero until the car confirms.
+	picking     bool      // The state of the car has shown the pickup.
+	pickedAt    time.Time // Zero until the car has picked the passenger up.
+}
+
+// Chooses the car for a destination call, or the car chosen before. Only the master answers.
+func (g *group) handleDestinationCall(message typedef.ElevatorMessage) {
+	call := message.Call
+	if !g.isMaster() || g.recall.On || call.Origin == call.Destination {
+		return
+	}
+	call.Panel = message.SenderIp
+	d, known := g.destinations[call]
+	if !known {
+		g.dispatchDestination(call)
+	} else if d.pickedAt.IsZero() {
+		printDebug("Destination call sent again, taken by " + d.car)
+		g.sendDestination(call, d)
+	}
+}
+
+func (g *group) dispatchDestination(call typedef.DestinationCall) {
+	states, _ := g.candidates()
+	elevator := CostFunction.CalculateDestinationElevator(call, states, g.traffic)
+	log.Printf("GROUP:\t Destination call from floor %d to %d, taken by %s.\n", call.Origin, call.Destination, elevator)
+	d := &dispatch{car: elevator}
+	g.destinations[call] = d
+	g.sendDestination(call, d)
+}
+
+func (g *group) sendDestination(call typedef.DestinationCall, d *dispatch) {
+	d.sentAt = time.Now()
+	g.sendMessage(typedef.ElevatorMessage{
+		Event:      typedef.EventDestinationAssigned,
+		SenderIp:   g.localIP,
+		AssignedTo: d.car,
+		State:      g.state,
+		Call:       call,
+	})
+	if d.car == g.localIP {
+		g.takeDestination(call)
+	}
+}
+
+/*
+	Gives this car the destination call the master assigned it, and confirms
+	it. A car which takes no hall calls does not, and the master gives the
+	call to another.
+*/
+func (g *group) takeDestination(call typedef.DestinationCall) {
+	if !g.state.TakesHallCalls() {
+		return
+	}
+	if g.channels.Destination != nil {
+		select {
+		case g.channels.Destination <- call:
+		case <-g.done:
+			return
+		}
+	}
+	g.sendMessage(typedef.ElevatorMessage{
+		Event:      typedef.EventDestinationConfirmed,
+		SenderIp:   g.localIP,
+		AssignedTo: g.localIP,
+		State:      g.state,
+		Call:       call,
+	})
+	g.confirmDestination(call, g.localIP)
+}
+
+func (g *group) confirmDestination(call typedef.DestinationCall, elevator string) {
+	if d, known := g.destinations[call]; known && d.car == elevator && d.confirmedAt.IsZero() {
+		d.confirmedAt = time.Now()
+	}
+}
+
+/*
+	Looks after the destination calls the master has dispatched, on every
+	tick. The pickup is seen in the state of the car, as a cab order at the
+	origin for the destination, and a car whose state has not shown it for
+	peerTimeout after the confirmation has served it already.
+*/
+func (g *group) checkDestinations() {
+	_, inService := g.candidates()
+	for call, d := range g.destinations {
+		if !d.pickedAt.IsZero() {
+			if time.Since(d.pickedAt) > callMemory {
+				delete(g.destinations, call)
+			}
+		} else if !g.isAlive(d.car) {
+			log.Printf("GROUP:\t Elevator %s is gone, reassigning its destination call from floor %d to %d.\n", d.car, call.Origin, call.Destination)
+			g.dispatchDestination(call)
+		} else if !g.canServe(d.car) && inService {
+			log.Printf("GROUP:\t Elevator %s takes no hall calls, reassigning its destination call from floor %d to %d.\n", d.car, call.Origin, call.Destination)
+			g.dispatchDestination(call)
+		} else if d.confirmedAt.IsZero() {
+			if time.Since(d.sentAt) > confirmTimeout {
+				g.sendDestination(call, d)
+			}
+		} else if state := g.stateOf(d.car); state.InternalOrders[call.Origin] && state.Destinations[call.Destination] {
+			d.picking = true
+		} else if d.picking || time.Since(d.confirmedAt) > peerTimeout {
+			printDebug("Destination call picked up by " + d.car)
+			d.pickedAt = time.Now()
+		}
+	}
+}
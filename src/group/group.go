@@ -0,0 +1,553 @@
+package group
+
+/*
+	This module makes the elevators on the network work as a group. It sits
+	between the elevator module and the network module.
+	Every elevator broadcasts its state and its view of the hall calls as an
+	EventNotifyAlive every aliveInterval, and the elevators it has heard from
+	within peerTimeout are alive. The alive elevator with the lowest ip is the
+	master. The master decides which elevator serves each hall call by using
+	the CostFunction module, and its view of the hall calls is copied by the
+	others. When an elevator dies the master gives its hall calls to the others.
+	So no hall calls are lost when a new master shows up, the master takes the
+	hall calls it does not know of from the others for peerTimeout after it
+	became master or met them, and they wait as long before copying it.
+	A hall button pressed at a slave is sent to the master as an EventNewOrder,
+	and a served hall call is sent as an EventOrderDone. Both are sent again
+	until the master's view shows them, in case a message is lost.
+	This module owns the hall call lamps, which are lit while a hall call has
+	an elevator serving it.
+	An elevator which is stopped sends an EventLeaving, so the others take over
+	its hall calls at once instead of waiting for peerTimeout.
+	An elevator whose state is out of service, or in a service mode, is given
+	no hall calls, and the master gives the ones it has to the others, like
+	for a dead elevator. When it is back in the group it is given the ones
+	nobody else could take again. A full elevator passes by the hall calls in
+	the way it is going, and the master gives them to another if one is
+	better.
+	The commands from the elev program and the panels, EventRecall,
+	EventService and EventDestinationCall, are taken from any sender, which is
+	not an elevator of the group. The destination calls are dispatched as in
+	destination.go.
+	Every elevator plans where the idle cars park from the states of the
+	alive elevators, see the parking module, and tells its own car where it
+	parks on the Park channel. The hall calls are assigned, and the cars
+	parked, by the traffic mode of the master, see traffic.go. The fire
+	recall is shared by the group as described in recall.go.
+*/
+
+import (
+	"context"
+	"costFunction"
+	"hardware"
+	"lifecycle"
+	"log"
+	"parking"
+	"strconv"
+	"time"
+	"traffic"
+	"typedef"
+)
+
+const debug = false
+
+const aliveInterval = 100 * time.Millisecond
+const peerTimeout = 1 * time.Second
+const leaveTimeout = 100 * time.Millisecond // How long to try to send the EventLeaving.
+
+// The channels the group talks to the other modules on.
+type Channels struct {
+	Send         chan<- typedef.ElevatorMessage // To the network module.
+	Receive      <-chan typedef.ElevatorMessage // From the network module.
+	HallCall     <-chan typedef.Order           // Hall buttons pressed at this elevator.
+	Done         <-chan typedef.Order           // Hall calls served by this elevator.
+	State        <-chan typedef.ElevatorState   // The state of this elevator.
+	Assign       chan<- typedef.Order           // Hall calls given to or taken from this elevator.
+	Light        chan<- hardware.LightEvent     // The hall call lamps.
+	Park         chan int                       // The park floor of this elevator, -1 for none. Buffered with size 1. May be nil.
+	RecallSwitch <-chan bool                    // The recall key switch of this elevator. May be nil.
+	Recall       chan<- bool                    // The fire recall turned on or off, to this elevator. May be nil.
+	Service      chan<- int                     // The service mode of this elevator, set by a command. May be nil.
+	Destination  chan<- typedef.DestinationCall // The destination calls this elevator takes. May be nil.
+}
+
+// How to run the group. The zero value parks no cars, and dispatches for inter-floor traffic.
+type Config struct {
+	Parking parking.Policy
+	Traffic traffic.Config
+}
+
+type peer struct {
+	state     typedef.ElevatorState
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+type group struct {
+	localIP      string
+	channels     Channels
+	state        typedef.ElevatorState
+	peers        map[string]*peer
+	hallOrders   [typedef.N_FLOORS][typedef.N_BUTTONS - 1]string // The ip serving each hall call, "" if none.
+	pendingCalls [typedef.N_FLOORS][typedef.N_BUTTONS - 1]bool   // Pressed here, not yet assigned by the master.
+	pendingDone  [typedef.N_FLOORS][typedef.N_BUTTONS - 1]bool   // Served here, not yet cleared by the master.
+	wasMaster    bool
+	masterSince  time.Time
+	parkFloor    int // Last sent on the Park channel.
+	detector     *traffic.Detector
+	traffic      int // The traffic mode.
+	recall       typedef.Recall
+	recallSwitch bool                                  // The recall key switch of this car is on.
+	destinations map[typedef.DestinationCall]*dispatch // Dispatched as the master, see destination.go.
+	config       Config
+	done         <-chan struct{}
+}
+
+/*
+	Starts the group as a goroutine for good. localIP is the ip the network
+	module returned, which is used to recognize the messages from this elevator.
+*/
+func Init(localIP string, channels Channels) {
+	Start(context.Background(), localIP, channels, Config{})
+}
+
+/*
+	Starts the group as a goroutine, which runs until the context is done or the
+	handle is closed. Then it tells the others it is leaving. The network module
+	must still be running by then for the message to be sent.
+*/
+func Start(ctx context.Context, localIP string, channels Channels, config Config) *lifecycle.Handle {
+	handle, ctx := lifecycle.New(ctx)
+	g := &group{localIP: localIP, channels: channels, peers: make(map[string]*peer), destinations: make(map[typedef.DestinationCall]*dispatch), parkFloor: -1, detector: traffic.NewDetector(config.Traffic), config: config, done: ctx.Done()}
+	handle.Go(func() { g.run(ctx) })
+	return handle
+}
+
+func (g *group) run(ctx context.Context) {
+	aliveTicker := time.NewTicker(aliveInterval)
+	defer aliveTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			g.leave()
+			return
+		case <-aliveTicker.C:
+			g.removeDeadPeers()
+			g.sendAlive()
+			g.resendPending()
+			if g.isMaster() {
+				if !g.wasMaster {
+					log.Println("GROUP:\t This elevator is the master.")
+					g.masterSince = time.Now()
+				}
+				g.reassignOrders()
+				g.checkDestinations()
+				g.updateTraffic()
+			}
+			g.wasMaster = g.isMaster()
+			g.planParking()
+		case message := <-g.channels.Receive:
+			if message.Event == typedef.EventRecall || message.Event == typedef.EventService || message.Event == typedef.EventDestinationCall {
+				g.handleCommand(message)
+			} else if message.SenderIp != g.localIP {
+				g.handleMessage(message)
+			}
+		case order := <-g.channels.HallCall:
+			g.handleHallCall(order)
+		case order := <-g.channels.Done:
+			g.handleDone(order)
+		case state := <-g.channels.State:
+			if state.TakesHallCalls() && !g.state.TakesHallCalls() {
+				g.takeBackHallOrders()
+			}
+			g.state = state
+		case on := <-g.channels.RecallSwitch:
+			g.handleRecallSwitch(on)
+		}
+	}
+}
+
+func (g *group) handleMessage(message typedef.ElevatorMessage) {
+	sender, known := g.peers[message.SenderIp]
+	if !known {
+		printDebug("New elevator: " + message.SenderIp)
+		sender = &peer{firstSeen: time.Now()}
+		g.peers[message.SenderIp] = sender
+	}
+	sender.lastSeen = time.Now()
+	order := message.Order
+	switch message.Event {
+	case typedef.EventNotifyAlive:
+		sender.state = message.State
+		g.mergeRecall(message.Recall)
+		if g.master() == message.SenderIp && time.Since(sender.firstSeen) > peerTimeout {
+			g.copyHallOrders(message.HallOrders)
+			g.setTraffic(message.Traffic)
+		} else if g.isMaster() && (time.Since(sender.firstSeen) < peerTimeout || time.Since(g.masterSince) < peerTimeout) {
+			g.mergeHallOrders(message.HallOrders)
+		}
+	case typedef.EventNewOrder:
+		if g.isMaster() {
+			g.assign(order.Floor, order.ButtonType)
+		}
+	case typedef.EventConfirmOrder, typedef.EventReassignOrder:
+		g.pendingCalls[order.Floor][order.ButtonType] = false
+		g.pendingDone[order.Floor][order.ButtonType] = false
+		g.setHallOrder(order.Floor, order.ButtonType, message.AssignedTo)
+	case typedef.EventOrderDone:
+		g.setHallOrder(order.Floor, order.ButtonType, "")
+	case typedef.EventDestinationAssigned:
+		if message.AssignedTo == g.localIP {
+			g.takeDestination(message.Call)
+		}
+	case typedef.EventDestinationConfirmed:
+		if g.isMaster() {
+			g.confirmDestination(message.Call, message.SenderIp)
+		}
+	case typedef.EventLeaving:
+		log.Printf("GROUP:\t Elevator %s is leaving.\n", message.SenderIp)
+		delete(g.peers, message.SenderIp)
+	}
+}
+
+func (g *group) handleCommand(message typedef.ElevatorMessage) {
+	switch message.Event {
+	case typedef.EventRecall:
+		g.handleRecallCommand(message)
+	case typedef.EventDestinationCall:
+		g.handleDestinationCall(message)
+	case typedef.EventService:
+		if message.AssignedTo != g.localIP || g.channels.Service == nil {
+			return
+		}
+		log.Printf("GROUP:\t Service command from %s.\n", message.SenderIp)
+		select {
+		case g.channels.Service <- message.State.Service:
+		case <-g.done:
+		}
+	}
+}
+
+func (g *group) handleHallCall(order typedef.Order) {
+	if g.recall.On {
+		return
+	} else if g.isMaster() {
+		g.assign(order.Floor, order.ButtonType)
+	} else if g.hallOrders[order.Floor][order.ButtonType] == "" {
+		g.pendingCalls[order.Floor][order.ButtonType] = true
+		g.send(typedef.EventNewOrder, order, "")
+	}
+}
+
+func (g *group) handleDone(order typedef.Order) {
+	g.setHallOrder(order.Floor, order.ButtonType, "")
+	if !g.isMaster() {
+		g.pendingDone[order.Floor][order.ButtonType] = true
+	}
+	g.send(typedef.EventOrderDone, order, "")
+}
+
+/*
+	Copies the master's view of the hall calls. Calls served here are not
+	copied until the master has cleared them, and calls pressed here are no
+	longer pending when the master has assigned them.
+*/
+func (g *group) copyHallOrders(hallOrders [typedef.N_FLOORS][typedef.N_BUTTONS - 1]string) {
+	for floor := range hallOrders {
+		for button, ip := range hallOrders[floor] {
+			if g.pendingDone[floor][button] {
+				if ip != "" {
+					continue
+				}
+				g.pendingDone[floor][button] = false
+			}
+			if ip != "" {
+				g.pendingCalls[floor][button] = false
+			}
+			g.setHallOrder(floor, button, ip)
+		}
+	}
+}
+
+// Takes the hall calls the master does not know of from another elevator's view.
+func (g *group) mergeHallOrders(hallOrders [typedef.N_FLOORS][typedef.N_BUTTONS - 1]string) {
+	for floor := range hallOrders {
+		for button, ip := range hallOrders[floor] {
+			if ip != "" && g.hallOrders[floor][button] == "" {
+				g.setHallOrder(floor, button, ip)
+			}
+		}
+	}
+}
+
+/*
+	Gives the hall call to the best elevator, unless it is already served by one
+	that can and does not pass it by. If no elevator takes hall calls it is
+	given to the best of them, so it is served when one is back.
+*/
+func (g *group) assign(floor, buttonType int) {
+	current := g.hallOrders[floor][buttonType]
+	if g.recall.On || (current != "" && g.canServe(current) && !g.passes(current, buttonType)) {
+		return
+	} else if current == "" {
+		g.detector.Call(time.Now(), floor, buttonType)
+	}
+	states, _ := g.candidates()
+	elevator := CostFunction.CalculateRespondingElevator(floor, buttonType, states, g.traffic)
+	if elevator == current {
+		return
+	}
+	printDebug("Assigning hall call to " + elevator)
+	g.setHallOrder(floor, buttonType, elevator)
+	g.send(typedef.EventConfirmOrder, typedef.Order{Floor: floor, ButtonType: buttonType, Value: true}, elevator)
+}
+
+// Gives the hall calls of dead elevators to the others.
+func (g *group) reassignOrders() {
+	for floor := range g.hallOrders {
+		for button, ip := range g.hallOrders[floor] {
+			if ip != "" && !g.isAlive(ip) {
+				log.Printf("GROUP:\t Elevator %s is gone, reassigning its hall call at floor %d.\n", ip, floor)
+				g.assign(floor, button)
+			} else if _, inService := g.candidates(); ip != "" && !g.canServe(ip) && inService {
+				log.Printf("GROUP:\t Elevator %s takes no hall calls, reassigning its hall call at floor %d.\n", ip, floor)
+				g.assign(floor, button)
+			} else if ip != "" && g.passes(ip, button) {
+				g.assign(floor, button)
+				if g.hallOrders[floor][button] != ip {
+					log.Printf("GROUP:\t Elevator %s is full, gave its hall call at floor %d to %s.\n", ip, floor, g.hallOrders[floor][button])
+				}
+			} else if ip == "" && g.pendingCalls[floor][button] {
+				g.pendingCalls[floor][button] = false
+				g.assign(floor, button)
+			}
+		}
+	}
+}
+
+// Gives this elevator the hall calls it still has in the group's view, which it dropped when it left the group.
+func (g *group) takeBackHallOrders() {
+	for floor := range g.hallOrders {
+		for button, ip := range g.hallOrders[floor] {
+			if ip == g.localIP {
+				select {
+				case g.channels.Assign <- typedef.Order{Floor: floor, ButtonType: button, Value: true}:
+				case <-g.done:
+				}
+			}
+		}
+	}
+}
+
+/*
+	Sets which elevator serves a hall call, and updates the lamp and the orders
+	of this elevator to match.
+*/
+func (g *group) setHallOrder(floor, buttonType int, ip string) {
+	old := g.hallOrders[floor][buttonType]
+	if old == ip {
+		return
+	}
+	g.hallOrders[floor][buttonType] = ip
+	if (old == "") != (ip == "") {
+		select {
+		case g.channels.Light <- hardware.LightEvent{LightType: buttonType, Floor: floor, Value: ip != ""}:
+		case <-g.done:
+		}
+	}
+	if ip == g.localIP || old == g.localIP {
+		select {
+		case g.channels.Assign <- typedef.Order{Floor: floor, ButtonType: buttonType, Value: ip == g.localIP}:
+		case <-g.done:
+		}
+	}
+}
+
+func (g *group) sendAlive() {
+	g.sendMessage(typedef.ElevatorMessage{
+		Event:      typedef.EventNotifyAlive,
+		SenderIp:   g.localIP,
+		State:      g.state,
+		HallOrders: g.hallOrders,
+		Traffic:    g.traffic,
+		Recall:     g.recall,
+	})
+}
+
+// Sends the hall calls and served orders the master has not seen yet again.
+func (g *group) resendPending() {
+	if g.isMaster() {
+		return
+	}
+	for floor := range g.pendingCalls {
+		for button := range g.pendingCalls[floor] {
+			order := typedef.Order{Floor: floor, ButtonType: button}
+			if g.pendingCalls[floor][button] {
+				g.send(typedef.EventNewOrder, order, "")
+			}
+			if g.pendingDone[floor][button] {
+				g.send(typedef.EventOrderDone, order, "")
+			}
+		}
+	}
+}
+
+func (g *group) send(event int, order typedef.Order, assignedTo string) {
+	g.sendMessage(typedef.ElevatorMessage{
+		Event:      event,
+		SenderIp:   g.localIP,
+		Order:      order,
+		AssignedTo: assignedTo,
+		State:      g.state,
+	})
+}
+
+func (g *group) sendMessage(message typedef.ElevatorMessage) {
+	select {
+	case g.channels.Send <- message:
+	case <-g.done:
+	}
+}
+
+// Tells the others this elevator is leaving. Gives up after leaveTimeout if the network module is not listening.
+func (g *group) leave() {
+	timeout := time.NewTimer(leaveTimeout)
+	defer timeout.Stop()
+	select {
+	case g.channels.Send <- typedef.ElevatorMessage{Event: typedef.EventLeaving, SenderIp: g.localIP, State: g.state}:
+	case <-timeout.C:
+	}
+}
+
+func (g *group) removeDeadPeers() {
+	for ip, p := range g.peers {
+		if time.Since(p.lastSeen) > peerTimeout {
+			log.Printf("GROUP:\t Lost contact with elevator %s.\n", ip)
+			delete(g.peers, ip)
+		}
+	}
+}
+
+func (g *group) isAlive(ip string) bool {
+	_, alive := g.peers[ip]
+	return alive || ip == g.localIP
+}
+
+/*
+	The states of the alive elevators which take hall calls, and true. If no
+	elevator does it is all of them, and false.
+*/
+func (g *group) candidates() (map[string]typedef.ElevatorState, bool) {
+	all := map[string]typedef.ElevatorState{g.localIP: g.state}
+	for ip, p := range g.peers {
+		all[ip] = p.state
+	}
+	states := map[string]typedef.ElevatorState{}
+	for ip, state := range all {
+		if state.TakesHallCalls() {
+			states[ip] = state
+		}
+	}
+	if len(states) == 0 {
+		return all, false
+	}
+	return states, true
+}
+
+/*
+	Plans where the idle cars park, and gives this elevator its park floor
+	when it changes. A car is idle when it is in service and has no orders. A
+	moving car is counted at the floor it comes to next, which is where it is
+	parking if it is one floor away. The park floors of the traffic mode are
+	used instead of the ones of the policy in a peak. Without an idle time in
+	the policy only the peaks park the cars.
+*/
+func (g *group) planParking() {
+	if g.channels.Park == nil || (g.config.Parking.IdleTime == 0 && g.config.Traffic.IdleTime == 0) {
+		return
+	}
+	idle := map[string]int{}
+	states, _ := g.candidates()
+	for ip, state := range states {
+		if state.TakesHallCalls() && !state.HaveOrders() {
+			idle[ip] = state.Lastfloor
+			if state.Moving {
+				idle[ip] += state.Direction
+			}
+		}
+	}
+	policy := g.config.Parking
+	if floors := g.config.Traffic.ParkFloors(g.traffic, len(idle)); len(floors) > 0 {
+		policy.Floors, policy.Schedules = floors, nil
+	} else if policy.IdleTime == 0 {
+		policy.Floors, policy.Schedules = nil, nil
+	}
+	floor, planned := policy.Plan(time.Now(), idle)[g.localIP]
+	if !planned {
+		floor = -1
+	}
+	if floor == g.parkFloor {
+		return
+	}
+	printDebug("Parking at floor " + strconv.Itoa(floor))
+	g.parkFloor = floor
+	select {
+	case <-g.channels.Park:
+	default:
+	}
+	g.channels.Park <- floor
+}
+
+// Whether the elevator is alive and takes hall calls.
+func (g *group) canServe(ip string) bool {
+	if ip == g.localIP {
+		return g.state.TakesHallCalls()
+	}
+	p, alive := g.peers[ip]
+	return alive && p.state.TakesHallCalls()
+}
+
+// The state of the elevator, the zero state if it is dead.
+func (g *group) stateOf(ip string) typedef.ElevatorState {
+	if ip == g.localIP {
+		return g.state
+	}
+	var state typedef.ElevatorState
+	if p, alive := g.peers[ip]; alive {
+		state = p.state
+	}
+	return state
+}
+
+// Whether the elevator is full, and passes the hall call by.
+func (g *group) passes(ip string, buttonType int) bool {
+	if ip == g.localIP {
+		return g.state.Passes(buttonType)
+	}
+	p, alive := g.peers[ip]
+	return alive && p.state.Passes(buttonType)
+}
+
+// The master is the alive elevator with the lowest ip.
+func (g *group) master() string {
+	master := g.localIP
+	for ip := range g.peers {
+		if ip < master {
+			master = ip
+		}
+	}
+	return master
+}
+
+func (g *group) isMaster() bool {
+	return g.master() == g.localIP
+}
+
+/*
+	Helper function that prints to console if the program is in debug mode.
+*/
+func printDebug(s string) {
+	if debug {
+		log.Println("GROUP:\t", s)
+	}
+}
@@ -0,0 +1,80 @@
+package group
+
+/*
+	The fire recall of the group. It is turned on or off by the key switch of
+	any car, or by an EventRecall command, and every elevator sends the latest
+	recall it knows of with its state. The one with the highest Number wins,
+	and of two with the same Number the one which is on, so every elevator
+	ends up with the same recall, and one which is restarted takes it from the
+	others.
+	The recall stays on while the key switch of any car is on. A car whose
+	switch is on does not take a recall which is off, nor a command to turn
+	it off, but sends a recall which is on, numbered above it. So a car
+	restarted with its switch on, whose Number starts over at 0, is not
+	overruled by the others.
+	While the recall is on there are no hall calls: the ones there are, are
+	cleared, and new ones are ignored.
+*/
+
+import (
+	"log"
+	"typedef"
+)
+
+// The recall key switch of this car has been turned.
+func (g *group) handleRecallSwitch(on bool) {
+	g.recallSwitch = on
+	g.turnRecall(on)
+}
+
+// An EventRecall command, from any sender.
+func (g *group) handleRecallCommand(message typedef.ElevatorMessage) {
+	log.Printf("GROUP:\t Fire recall command from %s.\n", message.SenderIp)
+	g.turnRecall(message.Order.Value)
+}
+
+func (g *group) turnRecall(on bool) {
+	if !on && g.recallSwitch {
+		log.Println("GROUP:\t The recall key switch of this car is on, the fire recall stays on.")
+		on = true
+	}
+	if on != g.recall.On {
+		g.setRecall(typedef.Recall{On: on, Number: g.recall.Number + 1})
+	}
+}
+
+// Takes the recall of another elevator if it is later than this one's.
+func (g *group) mergeRecall(recall typedef.Recall) {
+	if recall.Number > g.recall.Number || (recall.Number == g.recall.Number && recall.On && !g.recall.On) {
+		if !recall.On && g.recallSwitch {
+			recall = typedef.Recall{On: true, Number: recall.Number + 1}
+		}
+		g.setRecall(recall)
+	}
+}
+
+func (g *group) setRecall(recall typedef.Recall) {
+	changed := recall.On != g.recall.On
+	g.recall = recall
+	if !changed {
+		return
+	}
+	if recall.On {
+		log.Println("GROUP:\t Fire recall, clearing the hall calls.")
+		for floor := range g.hallOrders {
+			for button := range g.hallOrders[floor] {
+				g.pendingCalls[floor][button] = false
+				g.pendingDone[floor][button] = false
+				g.setHallOrder(floor, button, "")
+			}
+		}
+	} else {
+		log.Println("GROUP:\t The fire recall is over.")
+	}
+	if g.channels.Recall != nil {
+		select {
+		case g.channels.Recall <- recall.On:
+		case <-g.done:
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package group
+
+/*
+	The traffic mode of the group, see the traffic module. The master detects
+	it from the hall calls it assigns, and sends it with its state, so the
+	others dispatch and park by the same mode. A new master starts counting
+	the hall calls anew.
+*/
+
+import (
+	"log"
+	"time"
+	"traffic"
+)
+
+// Finds the mode of the master.
+func (g *group) updateTraffic() {
+	g.setTraffic(g.detector.Mode(time.Now()))
+}
+
+func (g *group) setTraffic(mode int) {
+	if mode == g.traffic {
+		return
+	}
+	log.Printf("GROUP:\t The traffic is %s.\n", traffic.ModeName(mode))
+	g.traffic = mode
+}
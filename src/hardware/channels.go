@@ -51,3 +51,13 @@ const BUTTON_UP4            = -1
 const LIGHT_DOWN1           = -1
 const LIGHT_UP4             = -1
 
+//not on the lab elevator, only read with Config.DoorButtons
+const BUTTON_DOOR_OPEN      = (0x300+24)
+const BUTTON_DOOR_CLOSE     = (0x300+25)
+
+//not on the lab elevator, only read with Config.RecallSwitch
+const FIRE_RECALL           = (0x300+26)
+
+//analog in port 0, not on the lab elevator, only read with Config.LoadSensor
+const LOAD_SENSOR           = (0x000+0)
+
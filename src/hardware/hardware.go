@@ -2,7 +2,7 @@ package hardware
 /*
 	This is the module wich interact with the hardware of the elevator.
 	It runs as a separate goroutine wich continously 'pings' the hardware
-	for new information. It contains a continous loop which querys the 
+	for new information. It contains a continous loop which querys the
 	hardware for status of the order buttons and the floor sensors.
 	If it detects some new information, it calls the main module to handle it.
 	It also contains an interface where the main module can call the hardware
@@ -10,8 +10,13 @@ package hardware
 	order is completed and to set the engine direction(which means it goes up,
 	down or stops.).
 	It contains two internal functions which are used to simplify the main
-	loop. These functions check the button status' and floor status' 
-	respectively. 
+	loop. These functions check the button status' and floor status'
+	respectively.
+	The IO itself is done through an IODevice, which is the comedi driver on
+	the real elevator and the simulated elevator (simelev) otherwise. Every
+	elevator in a process has its own Hardware, so several can run side by side.
+	The goroutines run until the context given to Start is done. Then the motor
+	is stopped, and the hardware can be started again.
 */
 
 //		--------------------------------------------------------------------
@@ -26,15 +31,17 @@ package hardware
 
 
 import (
+	"context"
 	"fmt"
+	"lifecycle"
+	"log"
+	"sync"
 	"time"
 	"typedef"
-	"driver"
-	"log"
 	)
 
 
-// ------------------------- CONSTANT and VARIABLE DECLERATdriver.IONS
+// ------------------------- CONSTANT and VARIABLE DECLERATIONS
 var lightChannelMatrix = [typedef.N_FLOORS][typedef.N_BUTTONS]int {
 	{LIGHT_UP1, LIGHT_DOWN1, LIGHT_COMMAND1},
 	{LIGHT_UP2, LIGHT_DOWN2, LIGHT_COMMAND2},
@@ -62,6 +69,7 @@ type LightEvent struct{
 
 type MotorEvent struct{
 	MotorDirection int
+	StopFloor int // The floor the car will stop at, -1 if it is not known.
 }
 
 type FloorEvent struct{
@@ -69,39 +77,140 @@ type FloorEvent struct{
 	Floor int
 }
 
+/*
+	The interface to the elevator IO card. It is implemented by the comedi
+	driver (driver.Comedi) and by the simulated elevator (simelev.Elevator).
+*/
+type IODevice interface {
+	Init() error
+	SetBit(channel int)
+	ClearBit(channel int)
+	ReadBit(channel int) bool
+	WriteAnalog(channel, value int)
+	ReadAnalog(channel int) int
+}
+
+// One elevators hardware, talking to the elevator through io.
+type Hardware struct {
+	io          IODevice
+	mutex       sync.Mutex
+	initialized bool
+	motorSpeed  int
+	lampMutex   sync.Mutex
+	lamps       map[int]*lamp // The lamps which have been set, by channel.
+}
+
+// How to run the hardware. The zero values are the defaults.
+type Config struct {
+	PollingDelay time.Duration // Between each poll of the buttons and sensors. 0 is defaultPollingDelay.
+	MotorSpeed   int           // The analog value written to the motor when it runs. 0 is defaultMotorSpeed.
+
+	// How long an input must read the same before it changes. 0 is defaultDebounce.
+	ButtonDebounce      time.Duration
+	StopDebounce        time.Duration
+	ObstructionDebounce time.Duration
+	Debounce            map[Input]time.Duration // The windows of single inputs, instead of the ones above.
+	LongPress           time.Duration           // How long a button is held for an EdgeLongPress. 0 is defaultLongPress.
+	Inputs              chan<- InputEvent       // Every edge of every input is sent here, or dropped if it is full. nil sends none.
+
+	LampCheckInterval time.Duration // Between each readback of the lamps. 0 is defaultLampCheckInterval.
+	Errors            chan<- error  // The faulty lamps and failed motor commands are reported here. nil logs them.
+
+	MotorTimeout time.Duration     // How long the floor sensors may stay the same while the motor runs. 0 is defaultMotorTimeout.
+	MotorRetries int               // How many times a failed motor command is given again. 0 is defaultMotorRetries.
+	Faults       chan<- FaultEvent // The motor faults are sent here. nil sends none.
+
+	// The speed profile, see profile.go.
+	AccelerationTime time.Duration // From the creep speed to MotorSpeed after the car starts. 0 starts at MotorSpeed.
+	DecelerationTime time.Duration // Down to the creep speed before the floor the car stops at. 0 keeps MotorSpeed.
+	CreepSpeed       int           // The speed at the ends of the ramps. 0 is a quarter of MotorSpeed.
+	RampCurve        RampCurve
+
+	DoorButtons  bool // The elevator has door open and close buttons, which the lab elevators do not.
+	RecallSwitch bool // The elevator has a fire recall key switch, which the lab elevators do not.
+
+	LoadSensor bool       // The car has a load sensor, which the lab elevators do not. It reads the load in kg.
+	Load       chan<- int // The load of the car is sent here when it changes. nil sends none.
+}
+
 var PreviousFloor int
 var CurrentFloor int
 var CurrentDirection int
 var PreviousDirection int
-var initialized bool = false
-const motorspeed = 2800
+const defaultMotorSpeed = 2800
+const defaultPollingDelay = 10 * time.Millisecond
+const loadDeadband = 10 // kg the load must change by before it is sent again, so the noise of the sensor is not.
 
 
 
-//		-----------------------  FUNCTdriver.ION DECLERATdriver.IONS    -----------------------------------
+//		-----------------------  FUNCTION DECLERATIONS    -----------------------------------
 
+// Creates the hardware module for the elevator behind io. Call Init to start it.
+func New(io IODevice) *Hardware {
+	return &Hardware{io: io}
+}
 
-func Init(buttonChannel chan<- ButtonEvent, lightChannel <-chan LightEvent, motorChannel <-chan int, floorChannel chan<- FloorEvent, pollingDelay time.Duration) error{
-	if initialized{
-		return fmt.Errorf("Hardware is already initialized.")
+// Starts the hardware for good.
+func (hw *Hardware) Init(buttonChannel chan<- ButtonEvent, lightChannel <-chan LightEvent, motorChannel <-chan MotorEvent, floorChannel chan<- FloorEvent, pollingDelay time.Duration) error{
+	_, err := hw.Start(context.Background(), buttonChannel, lightChannel, motorChannel, floorChannel, Config{PollingDelay: pollingDelay})
+	return err
+}
+
+/*
+	Starts the hardware, and returns when the elevator is at a floor. It runs
+	until the context is done or the handle is closed, and then stops the motor.
+*/
+func (hw *Hardware) Start(ctx context.Context, buttonChannel chan<- ButtonEvent, lightChannel <-chan LightEvent, motorChannel <-chan MotorEvent, floorChannel chan<- FloorEvent, config Config) (*lifecycle.Handle, error){
+	hw.mutex.Lock()
+	defer hw.mutex.Unlock()
+	if hw.initialized{
+		return nil, fmt.Errorf("Hardware is already initialized.")
+	}
+	pollingDelay := config.PollingDelay
+	if pollingDelay == 0 {
+		pollingDelay = defaultPollingDelay
+	}
+	hw.motorSpeed = config.MotorSpeed
+	if hw.motorSpeed == 0 {
+		hw.motorSpeed = defaultMotorSpeed
+	}
+	if config.MotorTimeout == 0 {
+		config.MotorTimeout = defaultMotorTimeout
 	}
-	initSuccess := driver.IOInit()
+	if config.MotorRetries == 0 {
+		config.MotorRetries = defaultMotorRetries
+	}
+	initSuccess := hw.io.Init()
 	if initSuccess!=nil{
-		return fmt.Errorf("Unable to initialize hardware.")
+		return nil, fmt.Errorf("Unable to initialize hardware.")
 	}
-	resetLights()
+	hw.initialized = true
+	hw.resetLights()
 
-	setMotorDirection(typedef.DIR_STOP)
+	if err := hw.setMotorDirection(typedef.DIR_STOP); err != nil {
+		hw.initialized = false
+		return nil, err
+	}
 	// If initialized between floors, move down to nearest floor.
-	if checkFloor() == -1 {
+	if hw.checkFloor() == -1 {
 		fmt.Printf("HARDWARE:\t Starting between floors, going down.\n")
-		setMotorDirection(typedef.DIR_DOWN)
+		err := hw.setMotorDirection(typedef.DIR_DOWN)
+		deadline := time.Now().Add(config.MotorTimeout)
 		for {
-			if floor:= checkFloor(); floor != -1 {
+			if floor:= hw.checkFloor(); floor != -1 {
 				fmt.Printf("HARDWARE:\t INIT -> Arrived at floor: %d\n", floor)
-				setMotorDirection(typedef.DIR_STOP)
+				hw.setMotorDirection(typedef.DIR_STOP)
 				floorChannel <- FloorEvent{CurrentDirection: typedef.DIR_STOP, Floor: floor}
 				break
+			} else if err != nil || ctx.Err() != nil || time.Now().After(deadline) {
+				hw.setMotorDirection(typedef.DIR_STOP)
+				hw.initialized = false
+				if err == nil && ctx.Err() != nil {
+					err = ctx.Err()
+				} else if err == nil {
+					err = &MotorError{Direction: typedef.DIR_DOWN, Problem: fmt.Sprintf("no floor was reached in %v", config.MotorTimeout)}
+				}
+				return nil, err
 			} else {
 				time.Sleep(pollingDelay)
 			}
@@ -109,276 +218,241 @@ func Init(buttonChannel chan<- ButtonEvent, lightChannel <-chan LightEvent, moto
 	}
 
 	// Start goroutines to handle hardware events.
-	go controlLights(lightChannel)
-	go controlMotor(motorChannel)
-	go readButtons(buttonChannel, pollingDelay)
-	go readFloorSensors(floorChannel, pollingDelay)
-	return nil
+	handle, ctx := lifecycle.New(ctx)
+	handle.Cleanup(func(){
+		hw.mutex.Lock()
+		defer hw.mutex.Unlock()
+		hw.setMotorDirection(typedef.DIR_STOP)
+		hw.initialized = false
+	})
+	doorChannel := make(chan bool)
+	handle.Go(func(){ hw.controlLights(ctx, lightChannel, doorChannel) })
+	handle.Go(func(){ hw.controlMotor(ctx, motorChannel, doorChannel, config, pollingDelay) })
+	handle.Go(func(){ hw.readButtons(ctx, buttonChannel, config, pollingDelay) })
+	handle.Go(func(){ hw.readFloorSensors(ctx, floorChannel, pollingDelay) })
+	if config.LoadSensor && config.Load != nil {
+		handle.Go(func(){ hw.readLoadSensor(ctx, config.Load, pollingDelay) })
+	}
+	lampCheckInterval := config.LampCheckInterval
+	if lampCheckInterval == 0 {
+		lampCheckInterval = defaultLampCheckInterval
+	}
+	handle.Go(func(){ hw.checkLamps(ctx, config.Errors, lampCheckInterval) })
+	return handle, nil
 	// TODO -> Acceptance test!!!
 }
 
 
-// This function runs continously as a goroutine, pinging the hardware for button presses.
-func readButtons(buttonChannel chan<- ButtonEvent, pollingDelay time.Duration){
-	readingMatrix := [typedef.N_FLOORS][typedef.N_BUTTONS]bool{}
-	var stopButton bool = false
+/*
+	This function runs continously as a goroutine, pinging the hardware for
+	button presses. Every debounced edge is sent on config.Inputs, if it is not
+	nil and has room, so a slow reader does not hold up the polling. The
+	presses of the buttons are passed on as ButtonEvents with Value true. A
+	cab button held for the long press is passed on again with Value false,
+	which cancels its cab order. The obstruction and the fire recall key
+	switch are passed on when they change, with Value true while they are on.
+*/
+func (hw *Hardware) readButtons(ctx context.Context, buttonChannel chan<- ButtonEvent, config Config, pollingDelay time.Duration){
+	send := func(event ButtonEvent) {
+		select {
+		case buttonChannel <- event:
+		case <-ctx.Done():
+		}
+	}
+	pollingTicker := time.NewTicker(pollingDelay)
+	defer pollingTicker.Stop()
+	debouncers := newDebouncers(config)
 	var stopState bool = false
-	var obstructionSignal = false
 	// This while loop runs continously, pinging the hardware for button presses.
 	for {
-		// Check if there are any new orders(buttons pressed).
-		for floor := 0; floor < typedef.N_FLOORS; floor ++ {
-			for buttonType := typedef.BUTTON_CALL_UP; buttonType < typedef.BUTTON_COMMAND + 1; buttonType++ {
-				if checkButtonPressed(buttonType, floor) {
-					if !readingMatrix[floor][buttonType] {
-						readingMatrix[floor][buttonType] = true
-						// Pass a hardwareevent to the event channel.
-						buttonChannel <- ButtonEvent{ButtonType: buttonType, Floor: floor}
-					}
-				} else {
-					// Make sure readingMatrix is set to false for this button.
-					// This makes sure that the buttonChannel is not filled with events.
-					readingMatrix[floor][buttonType] = false
-				}
+		now := time.Now()
+		for _, d := range debouncers {
+			event, ok := d.sample(hw.io.ReadBit(d.channel), now)
+			if !ok {
+				continue
 			}
-		}
-		if checkStopSignal() {
-			if !stopButton {
-				stopButton = true
-				if stopButton && !stopState{
-					// First time we press stop
-					buttonChannel <- ButtonEvent{ButtonType: typedef.BUTTON_STOP, Value: true}
-					stopState=true
-				} else if stopButton &&stopState{
-					// Second time we press stop
-					buttonChannel <- ButtonEvent{ButtonType: typedef.BUTTON_STOP, Value: false}
-					stopState=false
+			if config.Inputs != nil {
+				select {
+				case config.Inputs <- event:
+				default:
 				}
-
-				
-			} else{
-				stopButton = false
 			}
-		}
-		if checkObstructionSignal() {
-			if !obstructionSignal {
-				obstructionSignal = true
-				
-			} else {
-				obstructionSignal = false
+			if (event.Type == typedef.OBSTRUCTION_SENS || event.Type == typedef.RECALL_SWITCH) && event.Edge != EdgeLongPress {
+				send(ButtonEvent{ButtonType: event.Type, Value: event.Edge == EdgePress})
 			}
+			if event.Type == typedef.BUTTON_COMMAND && event.Edge == EdgeLongPress {
+				send(ButtonEvent{ButtonType: event.Type, Floor: event.Floor, Value: false})
+			}
+			if event.Edge != EdgePress {
+				continue
+			}
+			switch event.Type {
+			case typedef.BUTTON_CALL_UP, typedef.BUTTON_CALL_DOWN, typedef.BUTTON_COMMAND, typedef.BUTTON_DOOR_OPEN, typedef.BUTTON_DOOR_CLOSE:
+				// Pass a hardwareevent to the event channel.
+				send(ButtonEvent{ButtonType: event.Type, Floor: event.Floor, Value: true})
+			case typedef.BUTTON_STOP:
+				// Every press of stop toggles it.
+				stopState = !stopState
+				send(ButtonEvent{ButtonType: typedef.BUTTON_STOP, Value: stopState})
+			}
+		}
+		select {
+		case <-pollingTicker.C:
+		case <-ctx.Done():
+			return
 		}
-		time.Sleep(pollingDelay)
 	}
 }
 
 // This function runs continously as a goroutine, pinging the hardware for floor arrivals.
-func readFloorSensors(floorChannel chan<- FloorEvent, pollingDelay time.Duration){
+func (hw *Hardware) readFloorSensors(ctx context.Context, floorChannel chan<- FloorEvent, pollingDelay time.Duration){
+	pollingTicker := time.NewTicker(pollingDelay)
+	defer pollingTicker.Stop()
 	lastFloor := -1
 	for{
-		floor := checkFloor()
+		floor := hw.checkFloor()
 		if (floor != -1) && (floor != lastFloor){
 			lastFloor = floor
-			setFloorIndicator(floor)
-			floorChannel <- FloorEvent{Floor: floor} 
-			}	
-		time.Sleep(pollingDelay)
+			hw.setFloorIndicator(floor)
+			select {
+			case floorChannel <- FloorEvent{Floor: floor}:
+			case <-ctx.Done():
+			}
+			}
+		select {
+		case <-pollingTicker.C:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
-// This function runs continously as a goroutine, waiting for orders to set lights.
-func controlLights(lightChannel <-chan LightEvent){
+// This function runs continously as a goroutine, pinging the load sensor for changes of the load.
+func (hw *Hardware) readLoadSensor(ctx context.Context, loadChannel chan<- int, pollingDelay time.Duration){
+	pollingTicker := time.NewTicker(pollingDelay)
+	defer pollingTicker.Stop()
+	lastLoad := -loadDeadband // So the first reading is sent.
+	for{
+		load := hw.io.ReadAnalog(LOAD_SENSOR)
+		if load > lastLoad+loadDeadband || load < lastLoad-loadDeadband || (load == 0 && lastLoad != 0) {
+			lastLoad = load
+			select {
+			case loadChannel <- load:
+			case <-ctx.Done():
+			}
+		}
+		select {
+		case <-pollingTicker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// This function runs continously as a goroutine, waiting for orders to set lights. The door lamp is passed on to controlMotor.
+func (hw *Hardware) controlLights(ctx context.Context, lightChannel <-chan LightEvent, doorChannel chan<- bool){
 	for{
 		select{
+			case <-ctx.Done():
+				return
 			case lightEvent:=<-lightChannel:
 				switch lightEvent.LightType{
 				case typedef.BUTTON_CALL_UP, typedef.BUTTON_CALL_DOWN, typedef.BUTTON_COMMAND:
-					setButtonLight(lightEvent.Floor, lightEvent.LightType, lightEvent.Value)
+					hw.setButtonLight(lightEvent.Floor, lightEvent.LightType, lightEvent.Value)
 				case typedef.BUTTON_STOP:
-					setStopLamp(lightEvent.Value)
+					hw.setStopLamp(lightEvent.Value)
 				case typedef.DOOR_LAMP:
-					setDoorLamp(lightEvent.Value)
+					select{
+					case doorChannel <- lightEvent.Value:
+					case <-ctx.Done():
+						return
+					}
 				default:
 					// Do some error handling.
 				}
-		}	
-	}
-}
-
-// This function runs continously as a goroutine, waiting for orders to set the motor direction
-func controlMotor(motorChannel <-chan int){
-	for {
-		select{
-			case motorEv :=<-motorChannel:
-				fmt.Printf("CONTROLMOTOR:\t Received direction: %d\n", motorEv)
-				setMotorDirection(motorEv)
 		}
 	}
 }
 
-
 // --------------------- Check hardware functions ----------------------------
-/*
-	This functions loops through the different types of buttons at all the
-	floors and checks if any buttons are pressed.
-*/
-func checkButtonPressed(buttonType, floor int) bool {
-	// TODO -> Do this better in terms of counter variable names and button types. Can this function be removed?
-	if driver.IOReadBit(buttonChannelMatrix[floor][buttonType]){
-		return true
-	} else {
-		return false
-	}
-}
-
 /*
 	This functions checks the sensor at a
 	given floor to see if the elevator is at that floor.
 */
-func checkFloor() int {
-	if driver.IOReadBit(SENSOR_FLOOR1) {
+func (hw *Hardware) checkFloor() int {
+	if hw.io.ReadBit(SENSOR_FLOOR1) {
 		return 0
-	} else if driver.IOReadBit(SENSOR_FLOOR2) {
+	} else if hw.io.ReadBit(SENSOR_FLOOR2) {
 		return 1
-	} else if driver.IOReadBit(SENSOR_FLOOR3) {
+	} else if hw.io.ReadBit(SENSOR_FLOOR3) {
 		return 2
-	} else if driver.IOReadBit(SENSOR_FLOOR4) {
+	} else if hw.io.ReadBit(SENSOR_FLOOR4) {
 		return 3
 	} else {
 		return -1
 	}
 }
 
-/*
-	This function checks the status of the stop button
-*/
-func checkStopSignal() bool {
-	return driver.IOReadBit(STOP)
-}
-
-/*
-	This function checks the status of the obstruction button/signal
-*/
-func checkObstructionSignal() bool {
-	return driver.IOReadBit(OBSTRUCTION)
-}
-
-
-// ------------------------ Set motor -----------------------------
-
-/*
-	This function/channel(called from another goroutine) sets the direction of
-	the motor(any other direction than 0/STOP means it will run in this direction
-	immediately).
-*/
-func setMotorDirection(direction int) error {
-	fmt.Printf("HARDWARE:\t Setting motor direction: %d\n", direction)
-	if direction == 0 {
-		driver.IOWriteAnalog(MOTOR, 0)
-	} else if direction > 0 {
-		driver.IOClearBit(MOTORDIR)
-		driver.IOWriteAnalog(MOTOR, motorspeed)
-	} else if direction < 0 {
-		driver.IOSetBit(MOTORDIR)
-		driver.IOWriteAnalog(MOTOR, motorspeed)
-	}
-
-	// TODO -> Do some acceptance test to see if the direction was set.
-	// return some error.New()..
-	// If acceptance test completes.
-	return nil
-}
-
 // ------------------------ Light functions --------------------------------
 
 /*
-	This function/channel (called from another goroutine) sets the light of a 
+	This function/channel (called from another goroutine) sets the light of a
 	specific type at the given floor to the specified value.
 */
-func setButtonLight(floor, buttonType int, value bool) error {
+func (hw *Hardware) setButtonLight(floor, buttonType int, value bool) error {
 	// TODO -> Some acceptance test for the arguments..
-	if value {
-		driver.IOSetBit(lightChannelMatrix[floor][buttonType])
-	} else {
-		driver.IOClearBit(lightChannelMatrix[floor][buttonType])
-	}
+	hw.setLamp(lightChannelMatrix[floor][buttonType], value)
 	return nil
 }
 
 /*
 	This function sets the indicator at a given floor.
 */
-func setFloorIndicator(floor int) {
+func (hw *Hardware) setFloorIndicator(floor int) {
 	// Binary encoding, one light is always on 00, 01, 10 or 11
 	if floor >= typedef.N_FLOORS || floor < 0 {
 		log.Println("HARDWARE:\t Tried to set indicator on invalid floor.")
 		// todo set floor to nearest valid floor.
 	}
-	if bool((floor & 0x02) != 0) {
-		driver.IOSetBit(LIGHT_FLOOR_IND1)
-	} else {
-		driver.IOClearBit(LIGHT_FLOOR_IND1)
-	}
-	if bool((floor & 0x01) != 0) {
-		driver.IOSetBit(LIGHT_FLOOR_IND2)
-	} else {
-		driver.IOClearBit(LIGHT_FLOOR_IND2)
-	}
+	hw.setLamp(LIGHT_FLOOR_IND1, (floor & 0x02) != 0)
+	hw.setLamp(LIGHT_FLOOR_IND2, (floor & 0x01) != 0)
 }
 
 /*
 	This function sets the value of the door lamp
-*/	
-func setDoorLamp(value bool) {
-	if value {
-		driver.IOSetBit(LIGHT_DOOR_OPEN)
-	} else {
-		driver.IOClearBit(LIGHT_DOOR_OPEN)
-	}
+*/
+func (hw *Hardware) setDoorLamp(value bool) {
+	hw.setLamp(LIGHT_DOOR_OPEN, value)
 }
 
 /*
 	This function sets the value of the stop lamp.
 */
-func setStopLamp(value bool) {
-	if value {
-		driver.IOSetBit(LIGHT_STOP)
-	} else {
-		driver.IOClearBit(LIGHT_STOP)
-	}
+func (hw *Hardware) setStopLamp(value bool) {
+	hw.setLamp(LIGHT_STOP, value)
 }
 
 
-func resetLights() {
+func (hw *Hardware) resetLights() {
 	for f:=0;f<typedef.N_FLOORS;f++{
 		for b:=typedef.BUTTON_CALL_UP;b<typedef.N_BUTTONS;b++{
-			setButtonLight(f, b, false)
+			hw.setButtonLight(f, b, false)
 		}
 	}
-	setStopLamp(false)
-	setDoorLamp(false)
-}
-
-// ----------------  Temporary functions to reset elevator from separate program. ----------------
-
-func ResetLights(){
-	resetLights()
+	hw.setStopLamp(false)
+	hw.setDoorLamp(false)
 }
 
-func SetMotorDirection(dir int){
-	setMotorDirection(dir)
+// Stops the motor and turns off all the lamps, when the elevator has been left running. The hardware must not be started.
+func (hw *Hardware) Reset() error {
+	hw.mutex.Lock()
+	defer hw.mutex.Unlock()
+	if hw.initialized {
+		return fmt.Errorf("Hardware is already initialized.")
+	}
+	if err := hw.io.Init(); err != nil {
+		return fmt.Errorf("Unable to initialize hardware.")
+	}
+	hw.setMotorDirection(typedef.DIR_STOP)
+	hw.resetLights()
+	return nil
 }
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
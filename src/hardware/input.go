@@ -0,0 +1,142 @@
+package hardware
+
+/*
+	The input conditioning of the hardware module. The buttons, the stop button
+	and the obstruction switch are read once per polling delay, and a reading
+	only counts when it has stayed the same for the debounce window of the
+	input, so contact bounce is not taken as several presses.
+	Every debounced change is an InputEvent: a press or a release, and a long
+	press when a button has been held for the long press time. The events are
+	timestamped with time.Now(), which carries the monotonic clock, so the
+	times can be compared with Sub even if the wall clock is changed.
+	The ButtonEvents of the elevator are made from the press edges, and from
+	both edges of the obstruction switch and the fire recall key switch.
+*/
+
+import (
+	"time"
+	"typedef"
+)
+
+// The edges of an input.
+const (
+	EdgePress = iota
+	EdgeRelease
+	EdgeLongPress // The button is still held, EdgeRelease follows.
+)
+
+const defaultDebounce = 20 * time.Millisecond
+const defaultLongPress = 1500 * time.Millisecond
+
+/*
+	An input of the elevator. Type is typedef.BUTTON_CALL_UP, BUTTON_CALL_DOWN
+	or BUTTON_COMMAND with the floor of the button, or typedef.BUTTON_STOP,
+	OBSTRUCTION_SENS, BUTTON_DOOR_OPEN, BUTTON_DOOR_CLOSE or RECALL_SWITCH,
+	which have floor 0.
+*/
+type Input struct {
+	Type  int
+	Floor int
+}
+
+// A debounced change of an input.
+type InputEvent struct {
+	Input
+	Edge int
+	Time time.Time     // When the input started to read as changed.
+	Held time.Duration // How long the button was held, for EdgeRelease and EdgeLongPress.
+}
+
+// One input and its debounced state.
+type debouncer struct {
+	input     Input
+	channel   int
+	window    time.Duration
+	longPress time.Duration // 0 is no long press.
+	state     bool          // The debounced reading.
+	changing  time.Time     // When the reading started to differ from state, zero if it does not.
+	pressed   time.Time     // When the input was last pressed.
+	long      bool          // Whether the long press of this press has been sent.
+}
+
+// The debounce windows of the inputs in the config, with the defaults filled in.
+func debounceWindow(config Config, input Input) time.Duration {
+	if window, ok := config.Debounce[input]; ok {
+		return window
+	}
+	window := config.ButtonDebounce
+	switch input.Type {
+	case typedef.BUTTON_STOP:
+		window = config.StopDebounce
+	case typedef.OBSTRUCTION_SENS:
+		window = config.ObstructionDebounce
+	}
+	if window == 0 {
+		window = defaultDebounce
+	}
+	return window
+}
+
+// Every input of the elevator, the order buttons first.
+func newDebouncers(config Config) []*debouncer {
+	longPress := config.LongPress
+	if longPress == 0 {
+		longPress = defaultLongPress
+	}
+	var debouncers []*debouncer
+	add := func(input Input, channel int) {
+		d := &debouncer{input: input, channel: channel, window: debounceWindow(config, input), longPress: longPress}
+		if input.Type == typedef.OBSTRUCTION_SENS || input.Type == typedef.RECALL_SWITCH {
+			d.longPress = 0
+		}
+		debouncers = append(debouncers, d)
+	}
+	for floor := 0; floor < typedef.N_FLOORS; floor++ {
+		for buttonType := typedef.BUTTON_CALL_UP; buttonType < typedef.N_BUTTONS; buttonType++ {
+			if channel := buttonChannelMatrix[floor][buttonType]; channel != -1 {
+				add(Input{Type: buttonType, Floor: floor}, channel)
+			}
+		}
+	}
+	add(Input{Type: typedef.BUTTON_STOP}, STOP)
+	add(Input{Type: typedef.OBSTRUCTION_SENS}, OBSTRUCTION)
+	if config.DoorButtons {
+		add(Input{Type: typedef.BUTTON_DOOR_OPEN}, BUTTON_DOOR_OPEN)
+		add(Input{Type: typedef.BUTTON_DOOR_CLOSE}, BUTTON_DOOR_CLOSE)
+	}
+	if config.RecallSwitch {
+		add(Input{Type: typedef.RECALL_SWITCH}, FIRE_RECALL)
+	}
+	return debouncers
+}
+
+/*
+	Takes a reading of the input at now, and returns the edge it makes, if any.
+	A change is only an edge when it has been read for the whole window.
+*/
+func (d *debouncer) sample(reading bool, now time.Time) (InputEvent, bool) {
+	if reading == d.state {
+		d.changing = time.Time{}
+		if d.state && d.longPress > 0 && !d.long && now.Sub(d.pressed) >= d.longPress {
+			d.long = true
+			return InputEvent{Input: d.input, Edge: EdgeLongPress, Time: now, Held: now.Sub(d.pressed)}, true
+		}
+		return InputEvent{}, false
+	}
+	if d.changing.IsZero() {
+		d.changing = now
+	}
+	if now.Sub(d.changing) < d.window {
+		return InputEvent{}, false
+	}
+	d.state = reading
+	event := InputEvent{Input: d.input, Time: d.changing}
+	d.changing = time.Time{}
+	if d.state {
+		event.Edge = EdgePress
+		d.pressed, d.long = event.Time, false
+	} else {
+		event.Edge, event.Held = EdgeRelease, event.Time.Sub(d.pressed)
+	}
+	return event, true
+}
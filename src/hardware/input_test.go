@@ -0,0 +1,106 @@
+package hardware
+
+import (
+	"testing"
+	"time"
+	"typedef"
+)
+
+const testWindow = 20 * time.Millisecond
+const testLongPress = 1500 * time.Millisecond
+
+// A reading of an input, at a time after the start.
+type reading struct {
+	at    time.Duration
+	value bool
+}
+
+// An edge the debouncer should make, at a time after the start.
+type edge struct {
+	at   time.Duration // When the sample making it is taken.
+	edge int
+	time time.Duration // The time of the event, when the reading started to change.
+	held time.Duration
+}
+
+func TestDebouncerSample(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name     string
+		readings []reading
+		edges    []edge
+	}{
+		{
+			name:     "clean press and release",
+			readings: []reading{{0, true}, {10 * ms, true}, {20 * ms, true}, {100 * ms, false}, {110 * ms, false}, {120 * ms, false}},
+			edges:    []edge{{20 * ms, EdgePress, 0, 0}, {120 * ms, EdgeRelease, 100 * ms, 100 * ms}},
+		},
+		{
+			name: "bounce on press",
+			readings: []reading{{0, true}, {5 * ms, false}, {10 * ms, true}, {15 * ms, false},
+				{20 * ms, true}, {30 * ms, true}, {40 * ms, true}},
+			edges: []edge{{40 * ms, EdgePress, 20 * ms, 0}},
+		},
+		{
+			name: "bounce on release",
+			readings: []reading{{0, true}, {20 * ms, true}, {200 * ms, false}, {205 * ms, true},
+				{210 * ms, false}, {220 * ms, false}, {230 * ms, false}},
+			edges: []edge{{20 * ms, EdgePress, 0, 0}, {230 * ms, EdgeRelease, 210 * ms, 210 * ms}},
+		},
+		{
+			name:     "spike shorter than the window",
+			readings: []reading{{0, true}, {10 * ms, false}, {20 * ms, false}, {40 * ms, false}},
+			edges:    nil,
+		},
+		{
+			name: "long press",
+			readings: []reading{{0, true}, {20 * ms, true}, {1000 * ms, true}, {1500 * ms, true},
+				{1600 * ms, true}, {2000 * ms, false}, {2020 * ms, false}},
+			edges: []edge{{20 * ms, EdgePress, 0, 0}, {1500 * ms, EdgeLongPress, 1500 * ms, 1500 * ms},
+				{2020 * ms, EdgeRelease, 2000 * ms, 2000 * ms}},
+		},
+		{
+			name: "long press once for each press",
+			readings: []reading{{0, true}, {20 * ms, true}, {1600 * ms, true}, {1700 * ms, false}, {1720 * ms, false},
+				{1800 * ms, true}, {1820 * ms, true}, {2000 * ms, true}, {3400 * ms, true}},
+			edges: []edge{{20 * ms, EdgePress, 0, 0}, {1600 * ms, EdgeLongPress, 1600 * ms, 1600 * ms},
+				{1720 * ms, EdgeRelease, 1700 * ms, 1700 * ms}, {1820 * ms, EdgePress, 1800 * ms, 0},
+				{3400 * ms, EdgeLongPress, 3400 * ms, 1600 * ms}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			d := &debouncer{input: Input{Type: typedef.BUTTON_COMMAND, Floor: 2}, window: testWindow, longPress: testLongPress}
+			var edges []edge
+			for _, r := range test.readings {
+				if event, ok := d.sample(r.value, start.Add(r.at)); ok {
+					if event.Input != d.input {
+						t.Errorf("an event of input %+v", event.Input)
+					}
+					edges = append(edges, edge{r.at, event.Edge, event.Time.Sub(start), event.Held})
+				}
+			}
+			if len(edges) != len(test.edges) {
+				t.Fatalf("edges %v, want %v", edges, test.edges)
+			}
+			for i := range edges {
+				if edges[i] != test.edges[i] {
+					t.Errorf("edge %d is %+v, want %+v", i, edges[i], test.edges[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDebouncerWithoutLongPress(t *testing.T) {
+	start := time.Now()
+	d := &debouncer{input: Input{Type: typedef.OBSTRUCTION_SENS}, window: testWindow}
+	d.sample(true, start)
+	if _, ok := d.sample(true, start.Add(testWindow)); !ok {
+		t.Fatal("no press")
+	}
+	if event, ok := d.sample(true, start.Add(10*testLongPress)); ok {
+		t.Errorf("an edge %d from a switch without long press", event.Edge)
+	}
+}
@@ -0,0 +1,187 @@
+package hardware
+
+/*
+	The lamps of the elevator. The hardware module keeps the state every lamp
+	should have, and every lamp is written through setLamp. The lamps are read
+	back every lamp check interval, and a lamp that reads otherwise is written
+	again. A lamp which still reads wrong after lampFaultChecks checks is
+	reported as faulty with a LampError, and it is rewritten as long as it
+	does. Reinit restores all the lamps from the table after the IO card is
+	initialized again. That is done when all of at least resetLamps lamps
+	which are on read off at once, since then the IO card has been reset and
+	ignores the outputs until it is initialized, and when a motor command
+	does not read back, see motor.go.
+*/
+
+import (
+	"context"
+	"fmt"
+	"lifecycle"
+	"log"
+	"time"
+	"typedef"
+)
+
+const defaultLampCheckInterval = 500 * time.Millisecond
+
+// How many checks in a row a lamp must read wrong to be faulty.
+const lampFaultChecks = 3
+
+// How many lamps must be on, and read off, to take it as a reset of the IO card instead of faulty lamps.
+const resetLamps = 2
+
+// A lamp which does not read back what it was set to.
+type LampError struct {
+	Channel int
+	Value   bool // What the lamp was set to.
+}
+
+func (err *LampError) Error() string {
+	return fmt.Sprintf("HARDWARE:\t %s (channel %#x) does not turn %s.", lampName(err.Channel), err.Channel, onOff(err.Value))
+}
+
+// The state of one lamp.
+type lamp struct {
+	value  bool
+	wrong  int  // The checks in a row the lamp has read wrong.
+	faulty bool // Whether it has been reported.
+}
+
+// Sets the lamp on the channel, and keeps it in the table.
+func (hw *Hardware) setLamp(channel int, value bool) {
+	if channel == -1 {
+		return
+	}
+	hw.lampMutex.Lock()
+	defer hw.lampMutex.Unlock()
+	if hw.lamps == nil {
+		hw.lamps = make(map[int]*lamp)
+	}
+	l, ok := hw.lamps[channel]
+	if !ok {
+		l = &lamp{}
+		hw.lamps[channel] = l
+	}
+	if l.value != value {
+		l.value, l.wrong = value, 0
+	}
+	hw.writeLamp(channel, value)
+}
+
+func (hw *Hardware) writeLamp(channel int, value bool) {
+	if value {
+		hw.io.SetBit(channel)
+	} else {
+		hw.io.ClearBit(channel)
+	}
+}
+
+// This function runs continously as a goroutine, reading back the lamps every interval.
+func (hw *Hardware) checkLamps(ctx context.Context, errorChannel chan<- error, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			faults, reset := hw.reconcileLamps()
+			if reset {
+				log.Println("HARDWARE:\t All the lamps which are on read off, initializing the IO card again.")
+				if err := hw.Reinit(); err != nil {
+					lifecycle.Report(errorChannel, err)
+				}
+			}
+			for _, err := range faults {
+				lifecycle.Report(errorChannel, err)
+			}
+		}
+	}
+}
+
+/*
+	Rewrites the lamps which read otherwise than the table, and returns the
+	ones which have become faulty. When the IO card seems to have been reset
+	nothing is rewritten, and reset is true.
+*/
+func (hw *Hardware) reconcileLamps() (faults []error, reset bool) {
+	hw.lampMutex.Lock()
+	defer hw.lampMutex.Unlock()
+	on, off := 0, 0
+	for channel, l := range hw.lamps {
+		if l.value {
+			on++
+			if !hw.io.ReadBit(channel) {
+				off++
+			}
+		}
+	}
+	if on >= resetLamps && off == on {
+		return nil, true
+	}
+	for channel, l := range hw.lamps {
+		if hw.io.ReadBit(channel) == l.value {
+			if l.faulty {
+				log.Printf("HARDWARE:\t %s (channel %#x) works again.\n", lampName(channel), channel)
+			}
+			l.wrong, l.faulty = 0, false
+			continue
+		}
+		hw.writeLamp(channel, l.value)
+		l.wrong++
+		if l.wrong >= lampFaultChecks && !l.faulty {
+			l.faulty = true
+			faults = append(faults, &LampError{Channel: channel, Value: l.value})
+		}
+	}
+	return faults, false
+}
+
+/*
+	Initializes the IO card again, when it has been reset or lost, and restores
+	every lamp to what it was set to. The hardware must be started.
+*/
+func (hw *Hardware) Reinit() error {
+	hw.mutex.Lock()
+	defer hw.mutex.Unlock()
+	if !hw.initialized {
+		return fmt.Errorf("Hardware is not initialized.")
+	}
+	if err := hw.io.Init(); err != nil {
+		return fmt.Errorf("Unable to initialize hardware.")
+	}
+	hw.lampMutex.Lock()
+	defer hw.lampMutex.Unlock()
+	for channel, l := range hw.lamps {
+		hw.writeLamp(channel, l.value)
+	}
+	return nil
+}
+
+// A name of the lamp on the channel, for the errors.
+func lampName(channel int) string {
+	names := []string{"The up lamp", "The down lamp", "The cab lamp"}
+	for floor := 0; floor < typedef.N_FLOORS; floor++ {
+		for buttonType := typedef.BUTTON_CALL_UP; buttonType < typedef.N_BUTTONS; buttonType++ {
+			if lightChannelMatrix[floor][buttonType] == channel {
+				return fmt.Sprintf("%s at floor %d", names[buttonType], floor)
+			}
+		}
+	}
+	switch channel {
+	case LIGHT_STOP:
+		return "The stop lamp"
+	case LIGHT_DOOR_OPEN:
+		return "The door lamp"
+	case LIGHT_FLOOR_IND1, LIGHT_FLOOR_IND2:
+		return "The floor indicator"
+	}
+	return "The lamp"
+}
+
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,224 @@
+package hardware
+
+/*
+	The motor of the elevator. Every motor command is checked by reading back
+	the MOTORDIR bit and the MOTOR analog value, and a running motor must be
+	confirmed by the floor sensors: they must change, the car leaving or
+	reaching a floor, within the motor timeout. When a command fails it is
+	reported as a MotorError and a FaultEvent, and given again. A command
+	which does not read back may have been lost by an IO card which has been
+	reset, so the card is initialized again before it. When it has
+	failed more than the motor retries in a row the motor is stopped, and the
+	car is out of service until the hardware is started again.
+	The door lamp is set here too, so the motor and the door are interlocked:
+	a motor start waits while the door lamp is on, and the door lamp waits
+	until the motor has stopped. The elevator module sends the motor and door
+	commands on separate channels, in whichever order they are taken.
+*/
+
+import (
+	"context"
+	"fmt"
+	"lifecycle"
+	"time"
+	"typedef"
+)
+
+const defaultMotorTimeout = 5 * time.Second
+const defaultMotorRetries = 2
+
+// A motor command which failed.
+type MotorError struct {
+	Direction int
+	Problem   string
+}
+
+func (err *MotorError) Error() string {
+	return fmt.Sprintf("HARDWARE:\t The motor command %d failed: %s.", err.Direction, err.Problem)
+}
+
+// A fault of the motor. When OutOfService is set the motor has been stopped for good.
+type FaultEvent struct {
+	Err          error
+	OutOfService bool
+}
+
+/*
+	This function runs continously as a goroutine, waiting for orders to set the
+	motor direction, and watching the floor sensors while the motor runs. The
+	speed follows the profile. The door lamp is set from doorChannel, see
+	above. The config has the defaults filled in by Start.
+*/
+func (hw *Hardware) controlMotor(ctx context.Context, motorChannel <-chan MotorEvent, doorChannel <-chan bool, config Config, pollingDelay time.Duration) {
+	timeout, retries := config.MotorTimeout, config.MotorRetries
+	pollingTicker := time.NewTicker(pollingDelay)
+	defer pollingTicker.Stop()
+
+	direction, stopFloor := typedef.DIR_STOP, -1
+	failed := false // The last command did not read back, and is given again at the next poll.
+	attempts := 0   // The commands in a row which have failed.
+	outOfService := false
+	doorOpen := false    // The door lamp is on.
+	doorWaiting := false // The door lamp waits for the motor to stop.
+	held := false        // The motor start waits for the door lamp to turn off.
+	sensor := hw.checkFloor()
+	lastFloor := sensor
+	deadline := time.Now()
+	speed := newProfile(config, hw.motorSpeed)
+	fail := func(err error) {
+		failed = true
+		outOfService = hw.motorFailed(ctx, config, err, &attempts, retries)
+	}
+	readbackFailed := func(err error) {
+		fail(err)
+		if outOfService {
+			return
+		}
+		if err := hw.Reinit(); err != nil {
+			lifecycle.Report(config.Errors, err)
+		}
+	}
+	command := func() {
+		fmt.Printf("CONTROLMOTOR:\t Received direction: %d\n", direction)
+		now := time.Now()
+		err := hw.setMotor(direction, speed.depart(now, hw.motorSpeed))
+		sensor, deadline, failed = hw.checkFloor(), now.Add(timeout), false
+		if err != nil {
+			readbackFailed(err)
+		}
+		if direction == typedef.DIR_STOP && !failed && doorWaiting {
+			hw.setDoorLamp(true)
+			doorOpen, doorWaiting = true, false
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case open := <-doorChannel:
+			if open && direction != typedef.DIR_STOP && !held && !outOfService {
+				doorWaiting = true
+				continue
+			}
+			hw.setDoorLamp(open)
+			doorOpen, doorWaiting = open, false
+			if !open && held {
+				held = false
+				command()
+			}
+		case motorEvent := <-motorChannel:
+			if outOfService {
+				continue
+			}
+			stopFloor = motorEvent.StopFloor
+			if motorEvent.MotorDirection == direction && !failed {
+				continue
+			}
+			direction, attempts = motorEvent.MotorDirection, 0
+			held = doorOpen && direction != typedef.DIR_STOP
+			if held {
+				fmt.Printf("CONTROLMOTOR:\t Direction %d waits for the door to close.\n", direction)
+				continue
+			}
+			command()
+		case <-pollingTicker.C:
+			if outOfService || held {
+				continue
+			}
+			floor := hw.checkFloor()
+			if floor != -1 {
+				lastFloor = floor
+			}
+			if failed {
+				command()
+			} else if direction == typedef.DIR_STOP {
+				continue
+			} else if floor != sensor {
+				speed.run(time.Now())
+				speed.passed(floor)
+				sensor, deadline, attempts = floor, time.Now().Add(timeout), 0
+			} else if time.Now().After(deadline) {
+				fail(&MotorError{Direction: direction, Problem: fmt.Sprintf("the floor sensors did not change in %v", timeout)})
+				continue
+			}
+			if direction == typedef.DIR_STOP || failed {
+				continue
+			}
+			now := time.Now()
+			speed.run(now)
+			if approaching(direction, stopFloor, lastFloor, floor) {
+				speed.brake(now)
+			}
+			if old := speed.speed; speed.next(now, hw.motorSpeed) != old {
+				if err := hw.setMotorSpeed(speed.speed); err != nil {
+					err.Direction = direction
+					readbackFailed(err)
+				}
+			}
+		}
+	}
+}
+
+/*
+	Reports the failed command, and returns whether the car is out of service,
+	when the command has failed more than retries times in a row. Then the
+	motor is stopped.
+*/
+func (hw *Hardware) motorFailed(ctx context.Context, config Config, err error, attempts *int, retries int) bool {
+	*attempts++
+	outOfService := *attempts > retries
+	lifecycle.Report(config.Errors, err)
+	if outOfService {
+		hw.setMotorDirection(typedef.DIR_STOP)
+		lifecycle.Report(config.Errors, fmt.Errorf("HARDWARE:\t The motor failed %d times in a row, the elevator is out of service.", *attempts))
+	}
+	if config.Faults != nil {
+		select {
+		case config.Faults <- FaultEvent{Err: err, OutOfService: outOfService}:
+		case <-ctx.Done():
+		}
+	}
+	return outOfService
+}
+
+/*
+	This function/channel(called from another goroutine) sets the direction of
+	the motor(any other direction than 0/STOP means it will run in this direction
+	immediately) at the motor speed. The direction and speed are read back, and
+	a MotorError is returned if they are not what was written.
+*/
+func (hw *Hardware) setMotorDirection(direction int) error {
+	if direction == typedef.DIR_STOP {
+		return hw.setMotor(direction, 0)
+	}
+	return hw.setMotor(direction, hw.motorSpeed)
+}
+
+// Sets the direction and the speed of the motor, and reads them back.
+func (hw *Hardware) setMotor(direction, speed int) error {
+	fmt.Printf("HARDWARE:\t Setting motor direction: %d\n", direction)
+	if direction == typedef.DIR_STOP {
+		speed = 0
+	} else if direction > 0 {
+		hw.io.ClearBit(MOTORDIR)
+	} else {
+		hw.io.SetBit(MOTORDIR)
+	}
+	if err := hw.setMotorSpeed(speed); err != nil {
+		err.Direction = direction
+		return err
+	}
+	if down := hw.io.ReadBit(MOTORDIR); direction != typedef.DIR_STOP && down != (direction < 0) {
+		return &MotorError{Direction: direction, Problem: "the direction bit does not read back"}
+	}
+	return nil
+}
+
+// Changes the speed of the running motor, and reads it back.
+func (hw *Hardware) setMotorSpeed(speed int) *MotorError {
+	hw.io.WriteAnalog(MOTOR, speed)
+	if read := hw.io.ReadAnalog(MOTOR); read != speed {
+		return &MotorError{Problem: fmt.Sprintf("the speed reads %d instead of %d", read, speed)}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package hardware
+
+/*
+	The speed profile of the motor. Instead of starting and stopping at full
+	speed, the car starts at the creep speed and ramps up to the motor speed
+	over the acceleration time. Between the floor before the one it stops at
+	and that floor, it ramps down to the creep speed over the deceleration
+	time, and creeps the rest of the way to the floor sensor, where the
+	elevator stops it. The floor it stops at is given by the elevator with
+	every MotorEvent. If it is not known the car slows down for the end floor.
+	The ramp down starts when the distance left to the floor sensor is what
+	it takes to slow down. The distance is counted as the speed times the
+	time, from when the car left the last floor sensor, and the distance
+	between two floor sensors is learned from the last time the car ran it.
+	Until the car has, it starts to slow down as soon as it leaves the floor
+	before.
+	The zero ramp times run the car at the motor speed the whole way, as
+	before.
+*/
+
+import (
+	"fmt"
+	"time"
+	"typedef"
+)
+
+// The shape of the speed ramps.
+type RampCurve int
+
+const (
+	RampLinear RampCurve = iota // The same change of speed all the way.
+	RampSmooth                  // Slow changes at the ends of the ramp and fast in the middle.
+)
+
+// Returns the curve with the name, "linear" or "smooth".
+func RampCurveByName(name string) (RampCurve, error) {
+	switch name {
+	case "linear":
+		return RampLinear, nil
+	case "smooth":
+		return RampSmooth, nil
+	}
+	return RampLinear, fmt.Errorf("HARDWARE:\t There is no ramp curve %q, use linear or smooth.", name)
+}
+
+// How far along the ramp the speed is, from 0 to 1, when the part done of it is done.
+func (curve RampCurve) at(done float64) float64 {
+	if done >= 1 {
+		return 1
+	} else if done <= 0 {
+		return 0
+	}
+	if curve == RampSmooth {
+		return done * done * (3 - 2*done)
+	}
+	return done
+}
+
+// The speed of the trips of the car.
+type profile struct {
+	config     Config
+	creepSpeed int
+	departed   time.Time
+	braking    time.Time // When the car started to slow down, zero until it has.
+	brakeSpeed int       // The speed when it started to slow down.
+	speed      int
+
+	// The distances are in speed times seconds.
+	counted  time.Time // When the distance was last counted.
+	distance float64   // Since the car left the last floor sensor.
+	between  bool      // Whether the car has left a floor sensor, and not reached the next.
+	segment  float64   // Between two floor sensors, 0 until the car has run it.
+}
+
+func newProfile(config Config, motorSpeed int) profile {
+	creepSpeed := config.CreepSpeed
+	if creepSpeed == 0 {
+		creepSpeed = motorSpeed / 4
+	}
+	return profile{config: config, creepSpeed: creepSpeed}
+}
+
+// Starts a trip, and returns the speed to start at.
+func (p *profile) depart(now time.Time, motorSpeed int) int {
+	p.departed, p.braking, p.counted = now, time.Time{}, now
+	p.speed = p.next(now, motorSpeed)
+	return p.speed
+}
+
+// Counts the distance run since the last time, at the speed the motor has run at.
+func (p *profile) run(now time.Time) {
+	p.distance += float64(p.speed) * now.Sub(p.counted).Seconds()
+	p.counted = now
+}
+
+// The floor sensors have changed to floor, -1 between floors.
+func (p *profile) passed(floor int) {
+	if floor == -1 {
+		p.distance, p.between = 0, true
+		return
+	}
+	if p.between {
+		p.segment = p.distance
+	}
+	p.between = false
+}
+
+// Starts to slow down if the distance left to the next floor sensor is what it takes, unless the car already is.
+func (p *profile) brake(now time.Time) {
+	if !p.braking.IsZero() || p.config.DecelerationTime <= 0 {
+		return
+	}
+	brakingDistance := float64(p.speed+p.creepSpeed) / 2 * p.config.DecelerationTime.Seconds()
+	if p.segment == 0 || p.segment-p.distance <= brakingDistance {
+		p.braking, p.brakeSpeed = now, p.speed
+	}
+}
+
+// Returns the speed the motor should run at now.
+func (p *profile) next(now time.Time, motorSpeed int) int {
+	speed := motorSpeed
+	if accelerationTime := p.config.AccelerationTime; accelerationTime > 0 {
+		done := float64(now.Sub(p.departed)) / float64(accelerationTime)
+		speed = p.creepSpeed + int(float64(motorSpeed-p.creepSpeed)*p.config.RampCurve.at(done))
+	}
+	if !p.braking.IsZero() {
+		done := float64(now.Sub(p.braking)) / float64(p.config.DecelerationTime)
+		braked := p.brakeSpeed - int(float64(p.brakeSpeed-p.creepSpeed)*p.config.RampCurve.at(done))
+		if braked < speed {
+			speed = braked
+		}
+	}
+	p.speed = speed
+	return speed
+}
+
+/*
+	Whether the car is on its way to the floor it stops at, between it and the
+	floor before. lastFloor is the last floor the car was at, and floor the
+	floor it is at now, -1 between floors.
+*/
+func approaching(direction, stopFloor, lastFloor, floor int) bool {
+	if stopFloor == -1 {
+		stopFloor = 0
+		if direction == typedef.DIR_UP {
+			stopFloor = typedef.N_FLOORS - 1
+		}
+	}
+	return floor == -1 && lastFloor != -1 && lastFloor+direction == stopFloor
+}
@@ -0,0 +1,100 @@
+package hardware
+
+/*
+	A test of the elevator hardware, to run before the elevator is put to
+	work: every lamp is turned on and off and read back, and the car is driven
+	to a floor and on to the next, which the floor sensors must see. The car is
+	stopped and the lamps are turned off when it is done.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"typedef"
+)
+
+// How long the car may take to reach a floor.
+const selfTestFloorTimeout = 10 * time.Second
+
+/*
+	Runs the self test, and returns what failed. The steps are passed to report
+	as they are done. The hardware must not be started.
+*/
+func (hw *Hardware) SelfTest(config Config, report func(step string)) error {
+	if err := hw.Reset(); err != nil {
+		return err
+	}
+	hw.motorSpeed = config.MotorSpeed
+	if hw.motorSpeed == 0 {
+		hw.motorSpeed = defaultMotorSpeed
+	}
+	pollingDelay := config.PollingDelay
+	if pollingDelay == 0 {
+		pollingDelay = defaultPollingDelay
+	}
+	defer hw.setMotorDirection(typedef.DIR_STOP)
+	defer hw.resetLights()
+
+	var problems []error
+	lamps := []int{LIGHT_STOP, LIGHT_DOOR_OPEN}
+	for floor := range lightChannelMatrix {
+		for _, channel := range lightChannelMatrix[floor] {
+			if channel != -1 {
+				lamps = append(lamps, channel)
+			}
+		}
+	}
+	for _, channel := range lamps {
+		hw.io.SetBit(channel)
+		on := hw.io.ReadBit(channel)
+		hw.io.ClearBit(channel)
+		if off := hw.io.ReadBit(channel); !on || off {
+			problems = append(problems, fmt.Errorf("HARDWARE:\t The lamp on channel %#x reads %v when on and %v when off.", channel, on, off))
+		}
+	}
+	report(fmt.Sprintf("Tested %d lamps.", len(lamps)))
+
+	floor := hw.checkFloor()
+	if floor == -1 {
+		report("Between floors, going down.")
+		var err error
+		if floor, err = hw.driveToFloor(typedef.DIR_DOWN, -1, pollingDelay); err != nil {
+			return errors.Join(append(problems, err)...)
+		} else if floor == -1 {
+			return errors.Join(append(problems, errors.New("HARDWARE:\t No floor sensor was reached going down."))...)
+		}
+	}
+	direction, next := typedef.DIR_UP, floor+1
+	if floor == typedef.N_FLOORS-1 {
+		direction, next = typedef.DIR_DOWN, floor-1
+	}
+	report(fmt.Sprintf("At floor %d, driving to floor %d.", floor, next))
+	if reached, err := hw.driveToFloor(direction, floor, pollingDelay); err != nil {
+		problems = append(problems, err)
+	} else if reached != next {
+		problems = append(problems, fmt.Errorf("HARDWARE:\t Driving from floor %d reached floor %d instead of %d.", floor, reached, next))
+	} else {
+		report(fmt.Sprintf("Reached floor %d.", next))
+	}
+	return errors.Join(problems...)
+}
+
+/*
+	Drives the car until a floor other than from is reached, and returns it.
+	Returns -1 on timeout, and the error if the motor command fails.
+*/
+func (hw *Hardware) driveToFloor(direction, from int, pollingDelay time.Duration) (int, error) {
+	defer hw.setMotorDirection(typedef.DIR_STOP)
+	if err := hw.setMotorDirection(direction); err != nil {
+		return -1, err
+	}
+	deadline := time.Now().Add(selfTestFloorTimeout)
+	for time.Now().Before(deadline) {
+		if floor := hw.checkFloor(); floor != -1 && floor != from {
+			return floor, nil
+		}
+		time.Sleep(pollingDelay)
+	}
+	return -1, nil
+}
@@ -0,0 +1,816 @@
+package harness
+
+/*
+	This module is a test harness which runs several complete elevators in one
+	process, so the elevators can be tested together without the lab. Every
+	elevator is a node on a simulated elevator (simelev), and they talk on an
+	in-memory network (udp.Bus), or UDP sockets on loopback, through a
+	udp.FaultInjector for each elevator, and a network.Authenticator when the
+	scenario has a key.
+	A Scenario is a script of steps, like pressing buttons, killing elevators
+	and breaking the network at given times. Run plays the script while watching the
+	elevators, and checks that
+		- every order is served within the deadline of the scenario, by an
+		  elevator stopping at the floor of the order. In the scenarios where
+		  cab orders may be cancelled, a cab order the elevator no longer has
+		  at the end is cancelled instead.
+		- no hall call is served by two elevators at the same time.
+		- no car moves with its door open.
+		- every car is at its end floor when the scenario ends, if it has one.
+		- every destination call is confirmed by a car, which stops at its
+		  origin and destination. If another car confirms it later, that
+		  car must stop there instead. The calls are made by a panel on the
+		  in-memory network, which sends them again until confirmed.
+		- elevators with different keys drop the messages from each other.
+		- every elevator stops within closeTimeout at the end.
+		- no message fails to decode. The other errors of the network are logged.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hardware"
+	"lifecycle"
+	"log"
+	"network"
+	"node"
+	"os"
+	"parking"
+	"path/filepath"
+	"simelev"
+	"sort"
+	"sync"
+	"time"
+	"traffic"
+	"typedef"
+	"udp"
+)
+
+const pollingDelay = 10 * time.Millisecond
+const watchInterval = 10 * time.Millisecond
+const messageSize = 4 * 1024
+const scenarioGroupID = "harness"
+const closeTimeout = 2 * time.Second
+const errorQueueSize = 64
+const motorTimeout = 1500 * time.Millisecond // Longer than the simulated car takes between the floor sensors.
+const capacity = 1000                        // Of every car, in kg.
+
+// The ports for the next loopback scenario. Every scenario gets new ones.
+var loopbackPort = 23001
+
+// The ip of the destination dispatch panel on the bus.
+const panelIP = "10.0.0.100"
+const panelRetry = 200 * time.Millisecond // How often the panel sends the calls no car has confirmed.
+
+// How long two elevators may have the same hall call, while the master is moving it between them.
+const doubleServiceGrace = 500 * time.Millisecond
+
+// The elevators in a scenario, the first one is "A".
+type Elevator struct {
+	StartFloor float64
+	Key        string        // The key of this elevator, if not the one of the scenario.
+	Codec      network.Codec // The codec the elevator sends with, nil is JSON.
+}
+
+type Scenario struct {
+	Name        string
+	Elevators   []Elevator
+	Steps       []Step
+	Deadline    time.Duration  // Every order must be served within this time after it was made.
+	Duration    time.Duration  // How long the scenario runs.
+	Faults      udp.FaultRule  // The network faults for every elevator from the start.
+	Seed        int64          // The seed of the fault injectors.
+	Loopback    bool           // Use UDP sockets on 127.0.0.1 with port offsets instead of the bus.
+	ReusePort   bool           // With Loopback, give every elevator its own IP 127.0.0.N sharing the ports with SO_REUSEPORT instead.
+	Key         string         // Authenticate the messages with this key. "" is no authentication.
+	MaxPacket   int            // The max packet size of the network module, 0 for its default.
+	MaxDoorHold time.Duration  // How long the doors may be held open, 0 for the default of the elevator module.
+	Parking     parking.Policy // Where the idle cars park, the zero value parks none.
+	EndFloors   []int          // The floor of each car when the scenario ends, nil for any.
+	Traffic     traffic.Config // How the group finds the traffic mode, the zero value keeps inter-floor.
+	EndDoors    []bool         // Whether the door of each car is open when the scenario ends, nil for any.
+	MayCancel   bool           // Cab orders may be cancelled, by pressing twice or by the anti-nuisance, instead of served.
+	Nuisance    int            // The stops in a row where nobody gets on or off before the cab orders are cancelled, 0 for never.
+	Ramps       time.Duration  // The acceleration and deceleration time of the motors, 0 runs them at full speed the whole way.
+	CreepSpeed  int            // The speed at the ends of the ramps, 0 for the default of the hardware module.
+}
+
+// A step of a scenario, made by PressHall, PressCab, CallDestination, SetObstruction, SetRecallSwitch, SetService, SetLoad, Kill, JamMotor, FlipLamp, ResetIO, CheckLamps, Leave, Restart, Partition, Heal or SetFaults.
+type Step struct {
+	At          time.Duration
+	Description string
+	do          func(h *harness) error
+}
+
+// The outcome of a scenario.
+type Result struct {
+	Scenario   string
+	Orders     []Order
+	Violations []string
+}
+
+func (result Result) Passed() bool {
+	return len(result.Violations) == 0
+}
+
+// An order made in a scenario, and when and by which elevator it was served.
+type Order struct {
+	Elevator   int // The elevator whose button was pressed.
+	Floor      int
+	ButtonType int
+	MadeAt     time.Duration
+	Served     bool
+	ServedAt   time.Duration
+	ServedBy   int
+	Cancelled  bool
+
+	madeAt time.Time
+	double time.Duration // When two elevators started serving the order at once.
+}
+
+func (order Order) String() string {
+	s := fmt.Sprintf("%s at floor %d pressed in %s at %v", buttonName(order.ButtonType), order.Floor, Name(order.Elevator), order.MadeAt)
+	if order.Served {
+		s += fmt.Sprintf(", served by %s at %v", Name(order.ServedBy), order.ServedAt)
+	} else if order.Cancelled {
+		s += ", cancelled"
+	}
+	return s
+}
+
+// -------------------------- Steps ----------------------------
+
+func PressHall(at time.Duration, elevator, floor, buttonType int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("press %s at floor %d in %s", buttonName(buttonType), floor, Name(elevator)),
+		do: func(h *harness) error {
+			return h.press(elevator, floor, buttonType)
+		},
+	}
+}
+
+func PressCab(at time.Duration, elevator, floor int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("press cab %d in %s", floor, Name(elevator)),
+		do: func(h *harness) error {
+			return h.press(elevator, floor, typedef.BUTTON_COMMAND)
+		},
+	}
+}
+
+// Makes a destination call at the panel. The car which confirms it must stop at the origin and the destination.
+func CallDestination(at time.Duration, origin, destination int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("call from floor %d to %d at the panel", origin, destination),
+		do: func(h *harness) error {
+			return h.callDestination(typedef.DestinationCall{Origin: origin, Destination: destination})
+		},
+	}
+}
+
+// Turns the obstruction switch of an elevator on or off.
+func SetObstruction(at time.Duration, elevator int, value bool) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("set the obstruction of %s %s", Name(elevator), map[bool]string{true: "on", false: "off"}[value]),
+		do: func(h *harness) error {
+			h.sims[elevator].SetObstruction(value)
+			return nil
+		},
+	}
+}
+
+// Turns the fire recall key switch of an elevator on or off.
+func SetRecallSwitch(at time.Duration, elevator int, value bool) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("set the recall switch of %s %s", Name(elevator), map[bool]string{true: "on", false: "off"}[value]),
+		do: func(h *harness) error {
+			h.sims[elevator].SetRecallSwitch(value)
+			return nil
+		},
+	}
+}
+
+// Puts an elevator in a service mode, like the service command of elev.
+func SetService(at time.Duration, elevator, mode int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("put %s in %s service", Name(elevator), typedef.ServiceName(mode)),
+		do: func(h *harness) error {
+			h.nodes[elevator].SetService(mode)
+			return nil
+		},
+	}
+}
+
+// Puts a load in the car of an elevator besides the passengers, in kg.
+func SetLoad(at time.Duration, elevator, kg int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("put %d kg in %s", kg, Name(elevator)),
+		do: func(h *harness) error {
+			h.sims[elevator].SetLoad(kg)
+			return nil
+		},
+	}
+}
+
+// Kills an elevator: it is cut off from the network and its car stops where it is.
+func Kill(at time.Duration, elevator int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("kill %s", Name(elevator)),
+		do: func(h *harness) error {
+			h.kill(elevator)
+			return nil
+		},
+	}
+}
+
+// Jams the car of an elevator: its motor runs, but the car does not move. It must go out of service.
+func JamMotor(at time.Duration, elevator int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("jam the motor of %s", Name(elevator)),
+		do: func(h *harness) error {
+			h.alive[elevator] = false
+			h.sims[elevator].JamMotor()
+			return nil
+		},
+	}
+}
+
+// Flips the lamp of a button behind the back of an elevator, which must set it right again.
+func FlipLamp(at time.Duration, elevator, floor, buttonType int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("flip the %s lamp at floor %d in %s", buttonName(buttonType), floor, Name(elevator)),
+		do: func(h *harness) error {
+			h.sims[elevator].FlipLamp(buttonType, floor)
+			return nil
+		},
+	}
+}
+
+// Resets the IO card of an elevator, which must initialize it again and restore its lamps.
+func ResetIO(at time.Duration, elevator int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("reset the IO card of %s", Name(elevator)),
+		do: func(h *harness) error {
+			h.sims[elevator].ResetIO()
+			return nil
+		},
+	}
+}
+
+/*
+	Checks that the lamps of an elevator show its floor and orders: the cab
+	lamps its cab orders, and the hall lamps the hall calls of the elevators
+	alive.
+*/
+func CheckLamps(at time.Duration, elevator int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("check the lamps of %s", Name(elevator)),
+		do: func(h *harness) error {
+			sim := h.sims[elevator]
+			if floor := sim.Floor(); floor != -1 && sim.FloorIndicator() != floor {
+				return fmt.Errorf("the floor indicator shows %d at floor %d", sim.FloorIndicator(), floor)
+			}
+			for floor := 0; floor < typedef.N_FLOORS; floor++ {
+				for buttonType := typedef.BUTTON_CALL_UP; buttonType < typedef.N_BUTTONS; buttonType++ {
+					want := false
+					for other, n := range h.nodes {
+						state := n.State()
+						if buttonType == typedef.BUTTON_COMMAND && other == elevator {
+							want = state.InternalOrders[floor]
+						} else if buttonType != typedef.BUTTON_COMMAND && h.alive[other] && state.ExternalOrders[floor][buttonType] {
+							want = true
+						}
+					}
+					if sim.ButtonLamp(buttonType, floor) != want {
+						return fmt.Errorf("the %s lamp at floor %d is %s", buttonName(buttonType), floor, map[bool]string{true: "on", false: "off"}[!want])
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Stops an elevator the way it is stopped by a signal: it tells the others it is leaving.
+func Leave(at time.Duration, elevator int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("%s leaves", Name(elevator)),
+		do: func(h *harness) error {
+			h.alive[elevator] = false
+			return h.close(elevator)
+		},
+	}
+}
+
+// Stops an elevator and starts it again on the same car and network. Its cab orders must survive.
+func Restart(at time.Duration, elevator int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("restart %s", Name(elevator)),
+		do: func(h *harness) error {
+			if err := h.close(elevator); err != nil {
+				return err
+			}
+			n, err := node.Start(context.Background(), h.sims[elevator], h.transports[elevator], h.configs[elevator])
+			if err != nil {
+				return err
+			}
+			h.nodes[elevator] = n
+			return nil
+		},
+	}
+}
+
+// Cuts the network between two elevators, in both directions.
+func Partition(at time.Duration, a, b int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("partition %s from %s", Name(a), Name(b)),
+		do: func(h *harness) error {
+			h.injectors[a].SetRule(h.nodes[b].IP, udp.FaultRule{Partitioned: true})
+			h.injectors[b].SetRule(h.nodes[a].IP, udp.FaultRule{Partitioned: true})
+			return nil
+		},
+	}
+}
+
+// Reconnects two elevators after a Partition.
+func Heal(at time.Duration, a, b int) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("heal %s and %s", Name(a), Name(b)),
+		do: func(h *harness) error {
+			h.injectors[a].ClearRule(h.nodes[b].IP)
+			h.injectors[b].ClearRule(h.nodes[a].IP)
+			return nil
+		},
+	}
+}
+
+// Sets the network faults for everything an elevator receives.
+func SetFaults(at time.Duration, elevator int, rule udp.FaultRule) Step {
+	return Step{
+		At:          at,
+		Description: fmt.Sprintf("set faults %+v in %s", rule, Name(elevator)),
+		do: func(h *harness) error {
+			h.injectors[elevator].SetRule("", rule)
+			return nil
+		},
+	}
+}
+
+// The name of an elevator in a scenario, "A" for the first.
+func Name(elevator int) string {
+	return string(rune('A' + elevator))
+}
+
+func buttonName(buttonType int) string {
+	switch buttonType {
+	case typedef.BUTTON_CALL_UP:
+		return "up"
+	case typedef.BUTTON_CALL_DOWN:
+		return "down"
+	}
+	return "cab"
+}
+
+// -------------------------- Running ----------------------------
+
+type harness struct {
+	bus        *udp.Bus
+	injectors  []*udp.FaultInjector
+	auth       []*network.Authenticator // nil for the elevators without a key.
+	keys       []string
+	sims       []*simelev.Elevator
+	nodes      []*node.Node
+	transports []udp.Transport
+	configs    []node.Config
+	served     [][]node.ServedOrder // By elevator, from the Served hook of its node. Kept through a restart.
+	servedLock sync.Mutex
+	stateDir   string // The state files of the elevators.
+	errors     chan error
+	alive      []bool
+	start      time.Time
+	orders     []*Order
+	violation  []string
+	openMoving []bool                    // The car has been seen moving with its door open.
+	panel      *panel                    // Started by the first destination call.
+	calls      []typedef.DestinationCall // Not confirmed yet.
+}
+
+// A destination dispatch panel, a network module of its own.
+type panel struct {
+	send    chan typedef.ElevatorMessage
+	receive chan typedef.ElevatorMessage
+	ip      string
+	handle  *lifecycle.Handle
+	number  int              // Of the last call.
+	sentAt  time.Time        // When the calls not confirmed were sent last.
+	taken   map[int]*takenBy // The car which confirmed each call, by its number.
+}
+
+// The car which took a destination call, and the stops it must make for it.
+type takenBy struct {
+	elevator int
+	stops    []*Order
+}
+
+// Runs the scenario, and returns what happened.
+func Run(scenario Scenario) Result {
+	result := Result{Scenario: scenario.Name}
+	h, err := startElevators(scenario)
+	if err != nil {
+		h.stop()
+		result.Violations = append(result.Violations, "Could not start the elevators: "+err.Error())
+		return result
+	}
+
+	steps := append([]Step(nil), scenario.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].At < steps[j].At })
+	watchTicker := time.NewTicker(watchInterval)
+	defer watchTicker.Stop()
+	h.start = time.Now()
+	for now := time.Duration(0); now < scenario.Duration; now = time.Since(h.start) {
+		for len(steps) > 0 && steps[0].At <= now {
+			log.Printf("HARNESS:\t %v: %s\n", now, steps[0].Description)
+			if err := steps[0].do(h); err != nil {
+				h.violate("Step %q failed: %s", steps[0].Description, err)
+			}
+			steps = steps[1:]
+		}
+		h.watch(now)
+		<-watchTicker.C
+	}
+	for elevator, floor := range scenario.EndFloors {
+		if at := h.sims[elevator].Floor(); at != floor {
+			h.violate("%s ended at floor %d instead of %d", Name(elevator), at, floor)
+		}
+	}
+	if scenario.MayCancel {
+		h.findCancelled()
+	}
+	for _, call := range h.calls {
+		h.violate("No car confirmed the destination call from floor %d to %d", call.Origin, call.Destination)
+	}
+	for elevator, open := range scenario.EndDoors {
+		if h.sims[elevator].DoorOpen() != open {
+			h.violate("%s ended with the door %s", Name(elevator), map[bool]string{true: "closed", false: "open"}[open])
+		}
+	}
+	h.stop()
+
+	for _, order := range h.orders {
+		if !order.Served && !order.Cancelled {
+			h.violate("Not served: %s", order)
+		} else if order.ServedAt-order.MadeAt > scenario.Deadline {
+			h.violate("Served too late: %s", order)
+		}
+		result.Orders = append(result.Orders, *order)
+	}
+	h.checkAuthentication()
+	result.Violations = h.violation
+	return result
+}
+
+func startElevators(scenario Scenario) (*harness, error) {
+	h := &harness{bus: udp.NewBus(), errors: make(chan error, errorQueueSize)}
+	stateDir, err := os.MkdirTemp("", "harness")
+	if err != nil {
+		return h, err
+	}
+	h.stateDir = stateDir
+	for i, elevator := range scenario.Elevators {
+		config := simelev.DefaultConfig
+		config.StartFloor = elevator.StartFloor
+		sim := simelev.New(config)
+		injector := udp.NewFaultInjector(scenario.Seed + int64(i))
+		injector.SetRule("", scenario.Faults)
+		transport := h.bus.Transport(fmt.Sprintf("10.0.0.%d", i+1))
+		if scenario.Loopback {
+			udpConfig := udp.Config{
+				LocalListenPort:     loopbackPort,
+				BroadcastListenPort: loopbackPort + len(scenario.Elevators),
+				MessageSize:         messageSize,
+				Loopback:            true,
+				PortOffset:          i,
+				LocalElevators:      len(scenario.Elevators),
+				Errors:              h.errors,
+			}
+			if scenario.ReusePort {
+				udpConfig.BindAddress = fmt.Sprintf("127.0.0.%d", i+2)
+				udpConfig.ReusePort = true
+				udpConfig.PortOffset = 0
+				udpConfig.LocalElevators = 0
+			}
+			transport = udp.ConfigTransport(udpConfig)
+		}
+		transport = injector.Transport(transport)
+		key := scenario.Key
+		if elevator.Key != "" {
+			key = elevator.Key
+		}
+		if key != "" {
+			authenticator, err := network.NewAuthenticator([]byte(key), scenarioGroupID)
+			if err != nil {
+				return h, err
+			}
+			transport = authenticator.Transport(transport)
+			h.auth = append(h.auth, authenticator)
+		} else {
+			h.auth = append(h.auth, nil)
+		}
+		h.keys = append(h.keys, key)
+		nodeConfig := node.Config{Network: network.Config{Codec: elevator.Codec, MaxPacketSize: scenario.MaxPacket, Errors: h.errors}}
+		nodeConfig.Hardware.PollingDelay = pollingDelay
+		nodeConfig.Hardware.MotorTimeout = motorTimeout
+		nodeConfig.Hardware.Errors = h.errors
+		nodeConfig.Hardware.RecallSwitch = true
+		nodeConfig.Hardware.LoadSensor = true
+		nodeConfig.Hardware.AccelerationTime = scenario.Ramps
+		nodeConfig.Hardware.DecelerationTime = scenario.Ramps
+		nodeConfig.Hardware.CreepSpeed = scenario.CreepSpeed
+		nodeConfig.Elevator.Capacity = capacity
+		nodeConfig.Elevator.NuisanceStops = scenario.Nuisance
+		nodeConfig.Elevator.StateFile = filepath.Join(stateDir, Name(i))
+		nodeConfig.Elevator.MaxDoorHoldTime = scenario.MaxDoorHold
+		nodeConfig.Elevator.Parking = scenario.Parking
+		nodeConfig.Traffic = scenario.Traffic
+		index := i
+		h.served = append(h.served, nil)
+		nodeConfig.Served = func(order node.ServedOrder) {
+			h.servedLock.Lock()
+			defer h.servedLock.Unlock()
+			h.served[index] = append(h.served[index], order)
+		}
+		n, err := node.Start(context.Background(), sim, transport, nodeConfig)
+		if err != nil {
+			return h, err
+		}
+		h.transports = append(h.transports, transport)
+		h.configs = append(h.configs, nodeConfig)
+		h.injectors = append(h.injectors, injector)
+		h.sims = append(h.sims, sim)
+		h.nodes = append(h.nodes, n)
+		h.alive = append(h.alive, true)
+		h.openMoving = append(h.openMoving, false)
+	}
+	if scenario.Loopback {
+		loopbackPort += 2 * len(scenario.Elevators)
+	}
+	return h, nil
+}
+
+// Stops an elevator, and waits for it for closeTimeout at most.
+func (h *harness) close(elevator int) error {
+	closed := make(chan struct{})
+	go func() {
+		h.nodes[elevator].Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		return nil
+	case <-time.After(closeTimeout):
+		return fmt.Errorf("%s did not stop within %v", Name(elevator), closeTimeout)
+	}
+}
+
+// Stops all the elevators, the killed ones too, and removes their state files.
+func (h *harness) stop() {
+	if h.panel != nil {
+		h.panel.handle.Close()
+	}
+	for elevator := range h.nodes {
+		if err := h.close(elevator); err != nil {
+			h.violate("%s", err)
+		}
+	}
+	if h.stateDir != "" {
+		os.RemoveAll(h.stateDir)
+	}
+}
+
+func (h *harness) callDestination(call typedef.DestinationCall) error {
+	if h.panel == nil {
+		p := &panel{send: make(chan typedef.ElevatorMessage, 10), receive: make(chan typedef.ElevatorMessage, 100), taken: make(map[int]*takenBy)}
+		var err error
+		p.ip, p.handle, err = network.Start(context.Background(), h.bus.Transport(panelIP), network.Config{Errors: h.errors}, p.receive, p.send)
+		if err != nil {
+			return err
+		}
+		h.panel = p
+	}
+	h.panel.number++
+	call.Panel, call.Number = h.panel.ip, h.panel.number
+	h.calls = append(h.calls, call)
+	h.panel.send <- typedef.ElevatorMessage{Event: typedef.EventDestinationCall, SenderIp: h.panel.ip, Call: call}
+	h.panel.sentAt = time.Now()
+	return nil
+}
+
+/*
+	Takes the confirmations of the destination calls, and adds the stops of
+	the car which confirmed as orders. When another car confirms a call later,
+	the stops of the first are cancelled. The calls not confirmed are sent
+	again every panelRetry.
+*/
+func (h *harness) checkPanel() {
+	if h.panel == nil {
+		return
+	}
+	if len(h.calls) > 0 && time.Since(h.panel.sentAt) > panelRetry {
+		for _, call := range h.calls {
+			h.panel.send <- typedef.ElevatorMessage{Event: typedef.EventDestinationCall, SenderIp: h.panel.ip, Call: call}
+		}
+		h.panel.sentAt = time.Now()
+	}
+	for {
+		var message typedef.ElevatorMessage
+		select {
+		case message = <-h.panel.receive:
+		default:
+			return
+		}
+		call := message.Call
+		if message.Event != typedef.EventDestinationConfirmed || call.Panel != h.panel.ip {
+			continue
+		}
+		for i := range h.calls {
+			if h.calls[i] == call {
+				h.calls = append(h.calls[:i], h.calls[i+1:]...)
+				break
+			}
+		}
+		for elevator, n := range h.nodes {
+			taken := h.panel.taken[call.Number]
+			if n.IP != message.SenderIp || (taken != nil && taken.elevator == elevator) {
+				continue
+			} else if taken != nil {
+				log.Printf("HARNESS:\t The call from floor %d to %d is taken over from %s.\n", call.Origin, call.Destination, Name(taken.elevator))
+				for _, stop := range taken.stops {
+					stop.Cancelled = !stop.Served
+				}
+			}
+			log.Printf("HARNESS:\t The call from floor %d to %d is taken by %s.\n", call.Origin, call.Destination, Name(elevator))
+			taken = &takenBy{elevator: elevator}
+			for _, floor := range []int{call.Origin, call.Destination} {
+				stop := &Order{Elevator: elevator, Floor: floor, ButtonType: typedef.BUTTON_COMMAND, MadeAt: time.Since(h.start), madeAt: time.Now()}
+				taken.stops = append(taken.stops, stop)
+				h.orders = append(h.orders, stop)
+			}
+			h.panel.taken[call.Number] = taken
+		}
+	}
+}
+
+func (h *harness) press(elevator, floor, buttonType int) error {
+	if elevator < 0 || elevator >= len(h.sims) {
+		return fmt.Errorf("there is no elevator %s", Name(elevator))
+	}
+	h.sims[elevator].Press(buttonType, floor)
+	h.orders = append(h.orders, &Order{
+		Elevator:   elevator,
+		Floor:      floor,
+		ButtonType: buttonType,
+		MadeAt:     time.Since(h.start),
+		madeAt:     time.Now(),
+	})
+	return nil
+}
+
+func (h *harness) kill(elevator int) {
+	h.alive[elevator] = false
+	h.injectors[elevator].SetRule("", udp.FaultRule{Partitioned: true})
+	for other, injector := range h.injectors {
+		if other != elevator {
+			injector.SetRule(h.nodes[elevator].IP, udp.FaultRule{Partitioned: true})
+		}
+	}
+	h.sims[elevator].PowerOff()
+}
+
+/*
+	Checks the orders against what the alive elevators have done. An order is
+	served when an elevator reports it has served it, and that elevator must
+	then be at the floor of the order. Hall calls can be served by any elevator,
+	cab orders only by their own. No car may run its motor with the door open.
+*/
+func (h *harness) watch(now time.Duration) {
+	h.checkErrors()
+	h.checkPanel()
+	for elevator, sim := range h.sims {
+		if h.alive[elevator] && !h.openMoving[elevator] && sim.DoorOpen() && sim.ReadAnalog(hardware.MOTOR) != 0 {
+			h.violate("%s moved with the door open at %v", Name(elevator), now)
+			h.openMoving[elevator] = true
+		}
+	}
+	for _, order := range h.orders {
+		if order.Served {
+			continue
+		}
+		var holders []int
+		for elevator, n := range h.nodes {
+			if !h.alive[elevator] || (order.ButtonType == typedef.BUTTON_COMMAND && elevator != order.Elevator) {
+				continue
+			}
+			if h.hasServed(elevator, order) {
+				order.Served = true
+				order.ServedAt = now
+				order.ServedBy = elevator
+				if floor := h.sims[elevator].Floor(); floor != order.Floor {
+					h.violate("Served by %s at floor %d: %s", Name(elevator), floor, order)
+				}
+				break
+			}
+			state := n.State()
+			if order.ButtonType != typedef.BUTTON_COMMAND && state.ExternalOrders[order.Floor][order.ButtonType] {
+				holders = append(holders, elevator)
+			}
+		}
+
+		if len(holders) > 1 && !order.Served {
+			if order.double == 0 {
+				order.double = now
+			} else if order.double > 0 && now-order.double > doubleServiceGrace {
+				h.violate("Served by %d elevators at once: %s", len(holders), order)
+				order.double = -1
+			}
+		} else if order.double > 0 {
+			order.double = 0
+		}
+	}
+}
+
+// Marks the cab orders which are not served, and which the elevator no longer has, as cancelled.
+func (h *harness) findCancelled() {
+	for _, order := range h.orders {
+		if !order.Served && order.ButtonType == typedef.BUTTON_COMMAND && !h.nodes[order.Elevator].State().InternalOrders[order.Floor] {
+			order.Cancelled = true
+		}
+	}
+}
+
+func (h *harness) hasServed(elevator int, order *Order) bool {
+	h.servedLock.Lock()
+	defer h.servedLock.Unlock()
+	for _, served := range h.served[elevator] {
+		if served.Floor == order.Floor && served.ButtonType == order.ButtonType && !served.At.Before(order.madeAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Logs the errors reported by the elevators since the last check.
+func (h *harness) checkErrors() {
+	for {
+		select {
+		case err := <-h.errors:
+			var decodeError *network.DecodeError
+			if errors.As(err, &decodeError) {
+				h.violate("%s", err)
+			} else {
+				log.Println("HARNESS:\t", err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Checks that the elevators with a key have dropped the messages from the elevators with another key.
+func (h *harness) checkAuthentication() {
+	for elevator, authenticator := range h.auth {
+		if authenticator == nil {
+			continue
+		}
+		counters := authenticator.Counters()
+		log.Printf("HARNESS:\t Authentication in %s: %+v\n", Name(elevator), counters)
+		for other, key := range h.keys {
+			if key != h.keys[elevator] && counters.Unauthenticated == 0 {
+				h.violate("%s did not drop the messages from %s with another key", Name(elevator), Name(other))
+				break
+			}
+		}
+	}
+}
+
+func (h *harness) violate(format string, v ...interface{}) {
+	violation := fmt.Sprintf(format, v...)
+	log.Println("HARNESS:\t", violation)
+	h.violation = append(h.violation, violation)
+}
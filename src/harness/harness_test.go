@@ -0,0 +1,23 @@
+package harness
+
+import (
+	"testing"
+)
+
+// Runs every scenario as a subtest. They take real time, so they are skipped with -short.
+func TestScenarios(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the scenarios run simulated elevators in real time")
+	}
+	for _, scenario := range Scenarios {
+		t.Run(scenario.Name, func(t *testing.T) {
+			result := Run(scenario)
+			for _, order := range result.Orders {
+				t.Log(order)
+			}
+			for _, violation := range result.Violations {
+				t.Error(violation)
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package harness
+
+/*
+	The scenarios every change to the elevators should pass.
+*/
+
+import (
+	"network"
+	"parking"
+	"time"
+	"traffic"
+	"typedef"
+	"udp"
+)
+
+const (
+	A = iota
+	B
+	C
+)
+
+var Scenarios = []Scenario{
+	{
+		Name:      "one elevator serves hall and cab orders",
+		Elevators: []Elevator{{StartFloor: 0}},
+		Steps: []Step{
+			PressHall(0, A, 2, typedef.BUTTON_CALL_UP),
+			PressCab(500*time.Millisecond, A, 3),
+			PressHall(time.Second, A, 1, typedef.BUTTON_CALL_DOWN),
+		},
+		Deadline: 20 * time.Second,
+		Duration: 25 * time.Second,
+	},
+	{
+		Name:      "hall calls are shared by three elevators",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}, {StartFloor: 1}},
+		Steps: []Step{
+			PressHall(2*time.Second, A, 3, typedef.BUTTON_CALL_DOWN),
+			PressHall(2*time.Second, B, 0, typedef.BUTTON_CALL_UP),
+			PressHall(2*time.Second, C, 2, typedef.BUTTON_CALL_UP),
+			PressHall(3*time.Second, B, 1, typedef.BUTTON_CALL_DOWN),
+			PressCab(3*time.Second, C, 0),
+		},
+		Deadline: 15 * time.Second,
+		Duration: 20 * time.Second,
+	},
+	{
+		Name:      "hall call of a killed elevator is taken over",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			PressHall(2*time.Second, B, 1, typedef.BUTTON_CALL_UP),
+			Kill(2500*time.Millisecond, A),
+		},
+		Deadline: 15 * time.Second,
+		Duration: 20 * time.Second,
+	},
+	{
+		Name:      "hall calls are served on a lossy network",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			PressHall(2*time.Second, A, 3, typedef.BUTTON_CALL_DOWN),
+			PressHall(2*time.Second, B, 0, typedef.BUTTON_CALL_UP),
+			PressHall(3*time.Second, B, 2, typedef.BUTTON_CALL_DOWN),
+			PressHall(3*time.Second, A, 1, typedef.BUTTON_CALL_UP),
+		},
+		Deadline: 15 * time.Second,
+		Duration: 20 * time.Second,
+		Faults:   udp.FaultRule{Loss: 0.3, Latency: 20 * time.Millisecond, Jitter: 50 * time.Millisecond, Duplication: 0.1},
+		Seed:     1,
+	},
+	{
+		Name:      "both sides of a partition serve their hall calls",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			Partition(2*time.Second, A, B),
+			PressHall(4*time.Second, A, 2, typedef.BUTTON_CALL_UP),
+			PressHall(4*time.Second, B, 1, typedef.BUTTON_CALL_DOWN),
+			Heal(10*time.Second, A, B),
+			PressHall(12*time.Second, B, 0, typedef.BUTTON_CALL_UP),
+		},
+		Deadline: 15 * time.Second,
+		Duration: 25 * time.Second,
+	},
+	{
+		Name:      "elevators on one machine talk over loopback",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}, {StartFloor: 1}},
+		Steps: []Step{
+			PressHall(2*time.Second, A, 3, typedef.BUTTON_CALL_DOWN),
+			PressHall(2*time.Second, C, 0, typedef.BUTTON_CALL_UP),
+			PressHall(3*time.Second, B, 2, typedef.BUTTON_CALL_UP),
+			Kill(4*time.Second, C),
+			PressHall(6*time.Second, A, 1, typedef.BUTTON_CALL_DOWN),
+		},
+		Deadline: 15 * time.Second,
+		Duration: 20 * time.Second,
+		Loopback: true,
+	},
+	{
+		Name:      "elevators with their own IPs share the broadcast port",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}, {StartFloor: 1}},
+		Steps: []Step{
+			PressHall(2*time.Second, A, 3, typedef.BUTTON_CALL_DOWN),
+			PressHall(2*time.Second, C, 0, typedef.BUTTON_CALL_UP),
+			PressHall(3*time.Second, B, 2, typedef.BUTTON_CALL_UP),
+			Kill(4*time.Second, C),
+			PressHall(6*time.Second, A, 1, typedef.BUTTON_CALL_DOWN),
+		},
+		Deadline:  15 * time.Second,
+		Duration:  20 * time.Second,
+		Loopback:  true,
+		ReusePort: true,
+	},
+	{
+		Name:      "an elevator with another key is ignored",
+		Elevators: []Elevator{{StartFloor: 0, Key: "intruder"}, {StartFloor: 3}, {StartFloor: 1}},
+		Steps: []Step{
+			PressHall(2*time.Second, B, 0, typedef.BUTTON_CALL_UP),
+			PressHall(2*time.Second, A, 3, typedef.BUTTON_CALL_DOWN),
+			PressHall(3*time.Second, C, 2, typedef.BUTTON_CALL_UP),
+		},
+		Deadline: 15 * time.Second,
+		Duration: 20 * time.Second,
+		Key:      "the shared key",
+		Faults:   udp.FaultRule{Duplication: 0.5, Jitter: 30 * time.Millisecond},
+	},
+	{
+		Name:      "elevators with different codecs share hall calls",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3, Codec: network.Binary}, {StartFloor: 1, Codec: network.Binary}},
+		Steps: []Step{
+			PressHall(2*time.Second, A, 3, typedef.BUTTON_CALL_DOWN),
+			PressHall(2*time.Second, B, 0, typedef.BUTTON_CALL_UP),
+			PressHall(2*time.Second, C, 2, typedef.BUTTON_CALL_UP),
+			PressCab(3*time.Second, B, 1),
+			Kill(4*time.Second, A),
+			PressHall(6*time.Second, B, 2, typedef.BUTTON_CALL_DOWN),
+		},
+		Deadline: 15 * time.Second,
+		Duration: 20 * time.Second,
+	},
+	{
+		Name:      "messages split into fragments arrive",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			PressHall(2*time.Second, A, 3, typedef.BUTTON_CALL_DOWN),
+			PressHall(2*time.Second, B, 0, typedef.BUTTON_CALL_UP),
+			PressHall(3*time.Second, B, 2, typedef.BUTTON_CALL_DOWN),
+			Kill(4*time.Second, B),
+			PressHall(5*time.Second, A, 1, typedef.BUTTON_CALL_UP),
+		},
+		Deadline:  15 * time.Second,
+		Duration:  20 * time.Second,
+		Faults:    udp.FaultRule{Jitter: 20 * time.Millisecond, Duplication: 0.2},
+		Seed:      2,
+		MaxPacket: 100,
+	},
+	{
+		Name:      "hall call of a leaving elevator is taken over",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			PressHall(2*time.Second, B, 1, typedef.BUTTON_CALL_UP),
+			Leave(2500*time.Millisecond, A),
+		},
+		Deadline: 15 * time.Second,
+		Duration: 20 * time.Second,
+	},
+	{
+		Name:      "cab orders survive a restart",
+		Elevators: []Elevator{{StartFloor: 0}},
+		Steps: []Step{
+			PressCab(500*time.Millisecond, A, 3),
+			Restart(time.Second, A),
+		},
+		Deadline: 20 * time.Second,
+		Duration: 25 * time.Second,
+	},
+	{
+		Name:      "hall call of an elevator with a jammed motor is taken over",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			JamMotor(1500*time.Millisecond, A),
+			PressHall(2*time.Second, B, 1, typedef.BUTTON_CALL_UP),
+		},
+		Deadline: 15 * time.Second,
+		Duration: 20 * time.Second,
+	},
+	{
+		Name:      "cars with speed ramps slow down near the floor they stop at",
+		Elevators: []Elevator{{StartFloor: 0}},
+		Steps: []Step{
+			PressCab(time.Second, A, 2),
+			PressCab(7*time.Second, A, 3),
+			PressCab(13*time.Second, A, 2),
+		},
+		Deadline:   4 * time.Second, // Running the last floor at the creep speed takes longer.
+		Duration:   20 * time.Second,
+		EndFloors:  []int{2},
+		Ramps:      600 * time.Millisecond,
+		CreepSpeed: 700,
+	},
+	{
+		Name:      "lamps which drift or are lost in a reset are set right again",
+		Elevators: []Elevator{{StartFloor: 3}, {StartFloor: 0}},
+		Steps: []Step{
+			PressCab(500*time.Millisecond, B, 2),
+			FlipLamp(time.Second, B, 3, typedef.BUTTON_COMMAND),
+			ResetIO(time.Second, A),
+			CheckLamps(3*time.Second, A),
+			CheckLamps(3*time.Second, B),
+			PressCab(4*time.Second, A, 1),
+			PressHall(4*time.Second, B, 3, typedef.BUTTON_CALL_DOWN),
+			CheckLamps(5*time.Second, B),
+		},
+		Deadline: 10 * time.Second,
+		Duration: 14 * time.Second,
+	},
+	{
+		Name:      "an obstructed door is nudged closed",
+		Elevators: []Elevator{{StartFloor: 0}},
+		Steps: []Step{
+			PressCab(500*time.Millisecond, A, 0),
+			SetObstruction(time.Second, A, true),
+			PressCab(1500*time.Millisecond, A, 2),
+		},
+		MaxDoorHold: 4 * time.Second,
+		Deadline:    15 * time.Second,
+		Duration:    20 * time.Second,
+	},
+	{
+		Name:      "idle cars park in their zones",
+		Elevators: []Elevator{{StartFloor: 3}, {StartFloor: 2}},
+		Parking:   parking.Policy{IdleTime: 2 * time.Second, Floors: []int{0, 2}},
+		EndFloors: []int{2, 0},
+		Duration:  15 * time.Second,
+	},
+	{
+		Name:      "a parking car turns for a new order",
+		Elevators: []Elevator{{StartFloor: 3}},
+		Steps: []Step{
+			PressCab(2500*time.Millisecond, A, 3),
+		},
+		Parking:   parking.Policy{IdleTime: time.Second, Floors: []int{0}},
+		EndFloors: []int{0},
+		Deadline:  10 * time.Second,
+		Duration:  25 * time.Second,
+	},
+	{
+		Name:      "idle cars return to the lobby in up-peak",
+		Elevators: []Elevator{{StartFloor: 3}, {StartFloor: 2}},
+		Steps: []Step{
+			PressHall(time.Second, A, 0, typedef.BUTTON_CALL_UP),
+			PressHall(6*time.Second, B, 0, typedef.BUTTON_CALL_UP),
+			PressHall(11*time.Second, A, 0, typedef.BUTTON_CALL_UP),
+		},
+		Parking:   parking.Policy{IdleTime: 2 * time.Second, Floors: []int{3}},
+		Traffic:   traffic.Config{Window: time.Minute, MinCalls: 3, PeakShare: 0.6},
+		EndFloors: []int{0, 0},
+		Deadline:  10 * time.Second,
+		Duration:  30 * time.Second,
+	},
+	{
+		Name:      "idle cars return to the lobby in up-peak without a parking policy",
+		Elevators: []Elevator{{StartFloor: 3}, {StartFloor: 2}},
+		Steps: []Step{
+			PressHall(time.Second, A, 0, typedef.BUTTON_CALL_UP),
+			PressHall(6*time.Second, B, 0, typedef.BUTTON_CALL_UP),
+			PressCab(8*time.Second, B, 3),
+			PressHall(11*time.Second, A, 0, typedef.BUTTON_CALL_UP),
+			PressCab(13*time.Second, A, 2),
+		},
+		Traffic:   traffic.Config{Window: time.Minute, MinCalls: 3, PeakShare: 0.6, IdleTime: 2 * time.Second},
+		EndFloors: []int{0, 0},
+		Deadline:  10 * time.Second,
+		Duration:  30 * time.Second,
+	},
+	{
+		Name:      "a fire recall sends every car to the recall floor",
+		Elevators: []Elevator{{StartFloor: 3}, {StartFloor: 1}},
+		Steps: []Step{
+			SetRecallSwitch(time.Second, B, true),
+		},
+		EndFloors: []int{0, 0},
+		EndDoors:  []bool{true, true},
+		Duration:  15 * time.Second,
+	},
+	{
+		Name:      "a key switch turned on after a restart keeps the fire recall on",
+		Elevators: []Elevator{{StartFloor: 3}, {StartFloor: 2}},
+		Steps: []Step{
+			SetRecallSwitch(time.Second, A, true),
+			SetRecallSwitch(2*time.Second, A, false),
+			Partition(2500*time.Millisecond, A, B),
+			Restart(3*time.Second, B),
+			SetRecallSwitch(3500*time.Millisecond, B, true),
+			Heal(4500*time.Millisecond, A, B),
+		},
+		EndFloors: []int{0, 0},
+		EndDoors:  []bool{true, true},
+		Duration:  15 * time.Second,
+	},
+	{
+		Name:      "a car in inspection hands its hall calls back and keeps its mode",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			PressHall(500*time.Millisecond, B, 1, typedef.BUTTON_CALL_UP),
+			SetService(700*time.Millisecond, A, typedef.ServiceInspection),
+			Restart(5*time.Second, A),
+			PressCab(7*time.Second, A, 3),
+		},
+		EndFloors: []int{3, 1},
+		Deadline:  10 * time.Second,
+		Duration:  20 * time.Second,
+	},
+	{
+		Name:      "a car in independent service waits with the door open for one cab call",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			SetService(500*time.Millisecond, A, typedef.ServiceIndependent),
+			PressHall(1500*time.Millisecond, B, 0, typedef.BUTTON_CALL_UP),
+			PressCab(2*time.Second, A, 2),
+		},
+		EndFloors: []int{2, 0},
+		EndDoors:  []bool{true, false},
+		Deadline:  10 * time.Second,
+		Duration:  20 * time.Second,
+	},
+	{
+		Name:      "destination calls to the same floor share a car",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			CallDestination(500*time.Millisecond, 1, 3),
+			CallDestination(600*time.Millisecond, 1, 3),
+			CallDestination(700*time.Millisecond, 2, 0),
+		},
+		EndFloors: []int{3, 0},
+		Deadline:  10 * time.Second,
+		Duration:  20 * time.Second,
+	},
+	{
+		Name:      "a destination call of a killed car is taken over",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			CallDestination(time.Second, 2, 0),
+			Kill(1500*time.Millisecond, B),
+		},
+		Deadline: 10 * time.Second,
+		Duration: 15 * time.Second,
+	},
+	{
+		Name:      "a full car passes a hall call by for another car",
+		Elevators: []Elevator{{StartFloor: 0}, {StartFloor: 3}},
+		Steps: []Step{
+			PressHall(500*time.Millisecond, A, 1, typedef.BUTTON_CALL_UP),
+			PressCab(time.Second, A, 3),
+			SetLoad(1200*time.Millisecond, A, 900),
+		},
+		EndFloors: []int{3, 1},
+		Deadline:  10 * time.Second,
+		Duration:  20 * time.Second,
+	},
+	{
+		Name:      "a cab order pressed twice is cancelled",
+		Elevators: []Elevator{{StartFloor: 0}},
+		Steps: []Step{
+			PressCab(500*time.Millisecond, A, 2),
+			PressCab(500*time.Millisecond, A, 3),
+			PressCab(900*time.Millisecond, A, 3),
+		},
+		EndFloors: []int{2},
+		MayCancel: true,
+		Deadline:  10 * time.Second,
+		Duration:  15 * time.Second,
+	},
+	{
+		Name:      "the cab orders of an empty car are cancelled after quiet stops",
+		Elevators: []Elevator{{StartFloor: 0}},
+		Steps: []Step{
+			PressCab(500*time.Millisecond, A, 1),
+			PressCab(500*time.Millisecond, A, 2),
+			PressCab(500*time.Millisecond, A, 3),
+		},
+		EndFloors: []int{2},
+		MayCancel: true,
+		Nuisance:  2,
+		Deadline:  15 * time.Second,
+		Duration:  20 * time.Second,
+	},
+}
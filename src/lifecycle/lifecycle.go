@@ -0,0 +1,58 @@
+package lifecycle
+
+/*
+	The modules start their goroutines with a context, and return a Handle to
+	them. The goroutines run until the context is done or Close is called, and
+	Wait returns when they have all stopped and the module has cleaned up
+	after them, so the module can be started again. The errors the
+	goroutines run into are sent with Report.
+*/
+
+import (
+	"context"
+	"sync"
+)
+
+type Handle struct {
+	cancel   context.CancelFunc
+	running  sync.WaitGroup
+	once     sync.Once
+	cleanups []func()
+}
+
+// Returns a new handle, and the context the goroutines of the handle should stop on.
+func New(parent context.Context) (*Handle, context.Context) {
+	ctx, cancel := context.WithCancel(parent)
+	return &Handle{cancel: cancel}, ctx
+}
+
+// Runs f as a goroutine of the handle.
+func (handle *Handle) Go(f func()) {
+	handle.running.Add(1)
+	go func() {
+		defer handle.running.Done()
+		f()
+	}()
+}
+
+// Adds a function to run when all the goroutines have stopped, before Wait returns. Call it before starting them.
+func (handle *Handle) Cleanup(f func()) {
+	handle.cleanups = append(handle.cleanups, f)
+}
+
+// Stops the goroutines, and waits for them.
+func (handle *Handle) Close() {
+	handle.cancel()
+	handle.Wait()
+}
+
+// Waits until the goroutines have stopped and cleaned up, after the context is done or Close is called.
+func (handle *Handle) Wait() {
+	handle.running.Wait()
+	handle.once.Do(func() {
+		for i := len(handle.cleanups) - 1; i >= 0; i-- {
+			handle.cleanups[i]()
+		}
+		handle.cancel()
+	})
+}
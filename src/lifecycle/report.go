@@ -0,0 +1,17 @@
+package lifecycle
+
+import (
+	"log"
+)
+
+// Sends the error on the channel without waiting. It is logged if the channel is nil.
+func Report(errorChannel chan<- error, err error) {
+	if errorChannel == nil {
+		log.Println(err)
+		return
+	}
+	select {
+	case errorChannel <- err:
+	default:
+	}
+}
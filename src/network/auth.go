@@ -0,0 +1,254 @@
+package network
+
+/*
+	The Authenticator makes sure the elevators only listen to elevators of
+	their own group, and not to anything else on the LAN sending to our ports.
+	It sits between the network module and a udp.Transport, like the
+	udp.FaultInjector, and wraps every outgoing packet in a header with the
+	group ID, the sender and a sequence number, and an HMAC-SHA256 over it all
+	with the shared key:
+		| length | group ID | length | sender | sequence (8 bytes) | message | HMAC (32 bytes) |
+	Received packets are dropped and counted when
+		- the HMAC is wrong, or the packet is not from an authenticator at all.
+		- the group ID is not ours.
+		- the sequence number has been seen before from the sender, or is too
+		  old to tell (more than replayWindow behind the newest one).
+	The sequence numbers start at the time the elevator started, so they keep
+	growing when an elevator is restarted.
+*/
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"lifecycle"
+	"sync"
+	"time"
+	"udp"
+)
+
+// How many sequence numbers behind the newest one from a sender are still accepted, if not seen before.
+const replayWindow = 64
+
+const macSize = sha256.Size
+
+// The longest local ip in the header, an IPv4 address.
+const maxIPLength = len("255.255.255.255")
+
+// The most bytes an Authenticator with the group ID adds to a packet: the header and the HMAC.
+func AuthOverhead(groupID string) int {
+	return 2 + len(groupID) + maxIPLength + 8 + macSize
+}
+
+// The number of received packets accepted and dropped by an Authenticator.
+type AuthCounters struct {
+	Accepted        int
+	Unauthenticated int // Malformed, or with a wrong HMAC.
+	WrongGroup      int
+	Replayed        int
+}
+
+type Authenticator struct {
+	key     []byte
+	groupID string
+
+	mutex    sync.Mutex
+	sequence uint64
+	senders  map[string]*replayState
+	counters AuthCounters
+}
+
+// The sequence numbers seen from a sender.
+type replayState struct {
+	newest uint64
+	seen   uint64 // Bit i is set if newest-i has been seen.
+}
+
+/*
+	Returns an authenticator for the group with the shared key. Every elevator
+	in the group must have the same key and group ID.
+*/
+func NewAuthenticator(key []byte, groupID string) (*Authenticator, error) {
+	if len(key) == 0 {
+		return nil, errors.New("NETWORK:\t The shared key is empty.")
+	}
+	if len(groupID) > 255 {
+		return nil, errors.New("NETWORK:\t The group ID is longer than 255 bytes.")
+	}
+	return &Authenticator{
+		key:      append([]byte(nil), key...),
+		groupID:  groupID,
+		sequence: uint64(time.Now().UnixNano()),
+		senders:  make(map[string]*replayState),
+	}, nil
+}
+
+// Returns how many packets have been accepted and dropped so far.
+func (auth *Authenticator) Counters() AuthCounters {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+	return auth.counters
+}
+
+// Returns a Transport which authenticates the messages on their way to and from next.
+func (auth *Authenticator) Transport(next udp.Transport) udp.Transport {
+	return func(ctx context.Context, sendChannel <-chan udp.UDPMessage, receiveChannel chan<- udp.UDPMessage) (string, *lifecycle.Handle, error) {
+		nextSendChannel := make(chan udp.UDPMessage, cap(sendChannel))
+		nextReceiveChannel := make(chan udp.UDPMessage)
+		handle, ctx := lifecycle.New(ctx)
+		localIP, err := udp.StartNext(ctx, handle, next, nextSendChannel, nextReceiveChannel)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(localIP) > 255 {
+			handle.Close()
+			return "", nil, errors.New("NETWORK:\t The local IP is too long to authenticate.")
+		}
+		handle.Go(func() { auth.seal(ctx, localIP, sendChannel, nextSendChannel) })
+		handle.Go(func() { auth.open(ctx, nextReceiveChannel, receiveChannel) })
+		return localIP, handle, nil
+	}
+}
+
+// Seals the messages to send until the context is done, and then the ones left.
+func (auth *Authenticator) seal(ctx context.Context, localIP string, in <-chan udp.UDPMessage, out chan<- udp.UDPMessage) {
+	for {
+		var msg udp.UDPMessage
+		select {
+		case msg = <-in:
+		case <-ctx.Done():
+			select {
+			case msg = <-in:
+			default:
+				return
+			}
+		}
+		packet := auth.wrap(localIP, msg.Data)
+		out <- udp.UDPMessage{RAddress: msg.RAddress, Data: packet, Length: len(packet)}
+	}
+}
+
+// Wraps the data from localIP in the header and the HMAC, with the next sequence number.
+func (auth *Authenticator) wrap(localIP string, data []byte) []byte {
+	auth.mutex.Lock()
+	auth.sequence++
+	sequence := auth.sequence
+	auth.mutex.Unlock()
+
+	packet := make([]byte, 0, 2+len(auth.groupID)+len(localIP)+8+len(data)+macSize)
+	packet = append(packet, byte(len(auth.groupID)))
+	packet = append(packet, auth.groupID...)
+	packet = append(packet, byte(len(localIP)))
+	packet = append(packet, localIP...)
+	packet = binary.BigEndian.AppendUint64(packet, sequence)
+	packet = append(packet, data...)
+	return auth.appendMAC(packet, packet)
+}
+
+// Checks the received messages until the context is done.
+func (auth *Authenticator) open(ctx context.Context, in <-chan udp.UDPMessage, out chan<- udp.UDPMessage) {
+	for {
+		var msg udp.UDPMessage
+		select {
+		case msg = <-in:
+		case <-ctx.Done():
+			return
+		}
+		data, ok := auth.check(msg.Data[:msg.Length])
+		if !ok {
+			msg.Release()
+			continue
+		}
+		msg.Data, msg.Length = data, len(data)
+		select {
+		case out <- msg:
+		case <-ctx.Done():
+			msg.Release()
+			return
+		}
+	}
+}
+
+// Checks a received packet, and returns the message in it if it is accepted.
+func (auth *Authenticator) check(packet []byte) (data []byte, ok bool) {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+	if len(packet) < macSize {
+		return auth.drop(&auth.counters.Unauthenticated, "Dropped a packet too short to be authenticated.")
+	}
+	body, sum := packet[:len(packet)-macSize], packet[len(packet)-macSize:]
+	if !hmac.Equal(auth.appendMAC(nil, body), sum) {
+		return auth.drop(&auth.counters.Unauthenticated, "Dropped a packet with a wrong HMAC.")
+	}
+
+	groupID, body, ok := readString(body)
+	if !ok {
+		return auth.drop(&auth.counters.Unauthenticated, "Dropped a malformed packet.")
+	}
+	if groupID != auth.groupID {
+		return auth.drop(&auth.counters.WrongGroup, "Dropped a packet from group "+groupID)
+	}
+	sender, body, ok := readString(body)
+	if !ok || len(body) < 8 {
+		return auth.drop(&auth.counters.Unauthenticated, "Dropped a malformed packet.")
+	}
+	sequence := binary.BigEndian.Uint64(body)
+	if !auth.acceptSequence(sender, sequence) {
+		return auth.drop(&auth.counters.Replayed, "Dropped a replayed packet from "+sender)
+	}
+	auth.counters.Accepted++
+	return body[8:], true
+}
+
+/*
+	Accepts a sequence number from the sender if it is newer than any seen
+	before, or within the replay window and not seen before.
+*/
+func (auth *Authenticator) acceptSequence(sender string, sequence uint64) bool {
+	state, ok := auth.senders[sender]
+	if !ok {
+		auth.senders[sender] = &replayState{newest: sequence, seen: 1}
+		return true
+	}
+	if sequence > state.newest {
+		shift := sequence - state.newest
+		if shift >= replayWindow {
+			state.seen = 0
+		} else {
+			state.seen <<= shift
+		}
+		state.seen |= 1
+		state.newest = sequence
+		return true
+	}
+	behind := state.newest - sequence
+	if behind >= replayWindow || state.seen&(1<<behind) != 0 {
+		return false
+	}
+	state.seen |= 1 << behind
+	return true
+}
+
+func (auth *Authenticator) drop(counter *int, reason string) ([]byte, bool) {
+	*counter++
+	printDebug(reason)
+	return nil, false
+}
+
+// Appends the HMAC of data to b.
+func (auth *Authenticator) appendMAC(b, data []byte) []byte {
+	mac := hmac.New(sha256.New, auth.key)
+	mac.Write(data)
+	return mac.Sum(b)
+}
+
+// Reads a string prefixed by its length in one byte, and returns it and the rest.
+func readString(data []byte) (s string, rest []byte, ok bool) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return "", nil, false
+	}
+	length := int(data[0])
+	return string(data[1 : 1+length]), data[1+length:], true
+}
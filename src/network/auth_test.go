@@ -0,0 +1,84 @@
+package network
+
+import (
+	"testing"
+)
+
+func TestAcceptSequence(t *testing.T) {
+	tests := []struct {
+		name      string
+		sequences []uint64 // From one sender, in the order they arrive.
+		accepted  []bool
+	}{
+		{"in order", []uint64{10, 11, 12}, []bool{true, true, true}},
+		{"replayed", []uint64{10, 11, 10, 11}, []bool{true, true, false, false}},
+		{"late within the window", []uint64{10, 12, 11, 11}, []bool{true, true, true, false}},
+		{"late at the edge of the window", []uint64{100, 100 - replayWindow + 1, 100 - replayWindow}, []bool{true, true, false}},
+		{"too old after a jump", []uint64{10, 10 + replayWindow, 10}, []bool{true, true, false}},
+		{"a jump keeps only the newest", []uint64{10, 20, 20 + replayWindow, 21, 20 + replayWindow}, []bool{true, true, true, true, false}},
+		{"first one from a restart", []uint64{1000, 5}, []bool{true, false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := NewAuthenticator([]byte("key"), "group")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, sequence := range test.sequences {
+				if accepted := auth.acceptSequence("10.0.0.1", sequence); accepted != test.accepted[i] {
+					t.Errorf("sequence %d (number %d): accepted %t, want %t", sequence, i, accepted, test.accepted[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAcceptSequenceKeepsSendersApart(t *testing.T) {
+	auth, err := NewAuthenticator([]byte("key"), "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.acceptSequence("10.0.0.1", 10) || !auth.acceptSequence("10.0.0.2", 10) {
+		t.Error("the same sequence number from two senders was not accepted from both")
+	}
+	if auth.acceptSequence("10.0.0.2", 10) {
+		t.Error("a replayed sequence number was accepted")
+	}
+}
+
+func TestCheckDropsReplays(t *testing.T) {
+	auth, err := NewAuthenticator([]byte("key"), "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewAuthenticator([]byte("other key"), "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := auth.wrap("10.0.0.1", []byte("message"))
+	if data, ok := auth.check(packet); !ok || string(data) != "message" {
+		t.Fatalf("check(packet) = %q, %t, want the message", data, ok)
+	}
+	if _, ok := auth.check(packet); ok {
+		t.Error("a replayed packet was accepted")
+	}
+	if _, ok := other.check(auth.wrap("10.0.0.1", []byte("message"))); ok {
+		t.Error("a packet with another key was accepted")
+	}
+	counters := auth.Counters()
+	if counters.Accepted != 1 || counters.Replayed != 1 {
+		t.Errorf("counters %+v, want 1 accepted and 1 replayed", counters)
+	}
+}
+
+func TestAuthOverhead(t *testing.T) {
+	auth, err := NewAuthenticator([]byte("key"), "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("message")
+	packet := auth.wrap("255.255.255.255", data)
+	if overhead := len(packet) - len(data); overhead != AuthOverhead("group") {
+		t.Errorf("the Authenticator adds %d bytes, AuthOverhead says %d", overhead, AuthOverhead("group"))
+	}
+}
@@ -0,0 +1,305 @@
+package network
+
+/*
+	A Codec turns ElevatorMessages into packets and back. The network module
+	sends with the codec it was started with, and receives with any codec it
+	knows, since the packets are labeled:
+		- JSON packets are plain JSON, as they always were, so elevators without
+		  codecs still understand them. They start with '{'.
+		- Other packets start with a byte with the ID of their codec.
+	An elevator can then change to a new codec when all the elevators it talks
+	to know it.
+
+	The Binary codec is about a fifth of the size of JSON and five times as
+	fast, see BenchmarkCodecs in codec_test.go. It writes the fields in order,
+	the numbers as varints, the bools as bits and the strings with their
+	length first. The hall orders table holds the same few IPs many times, so
+	it is written as the list of the IPs, and the index in that list for each
+	hall call. The fields come after a byte with the version of the format,
+	binaryVersion, which is counted up whenever a field is added or changed,
+	so a packet of another version is rejected instead of read wrong.
+*/
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "typedef"
+)
+
+type Codec interface {
+	Name() string
+	Marshal(message ElevatorMessage) ([]byte, error)
+	Unmarshal(data []byte, message *ElevatorMessage) error
+}
+
+const binaryCodecID = 1
+const binaryVersion = 2
+
+var (
+	JSON   Codec = jsonCodec{}
+	Binary Codec = binaryCodec{}
+)
+
+// Returns the codec with the name, "json" or "binary".
+func CodecByName(name string) (Codec, error) {
+	for _, codec := range []Codec{JSON, Binary} {
+		if codec.Name() == name {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("NETWORK:\t There is no codec %q.", name)
+}
+
+// The codec of a received packet, from its first byte.
+func codecOf(data []byte) (Codec, error) {
+	if len(data) == 0 {
+		return nil, errors.New("NETWORK:\t Empty packet.")
+	}
+	switch data[0] {
+	case '{':
+		return JSON, nil
+	case binaryCodecID:
+		return Binary, nil
+	}
+	return nil, fmt.Errorf("NETWORK:\t Unknown codec %d.", data[0])
+}
+
+// Decodes a packet with the codec it is labeled with.
+func decode(data []byte, message *ElevatorMessage) error {
+	codec, err := codecOf(data)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, message)
+}
+
+// ----------------------------- JSON -----------------------------
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(message ElevatorMessage) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+func (jsonCodec) Unmarshal(data []byte, message *ElevatorMessage) error {
+	return json.Unmarshal(data, message)
+}
+
+// ---------------------------- Binary ----------------------------
+
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string {
+	return "binary"
+}
+
+func (binaryCodec) Marshal(message ElevatorMessage) ([]byte, error) {
+	data := make([]byte, 0, 64)
+	data = append(data, binaryCodecID, binaryVersion)
+	data = binary.AppendVarint(data, int64(message.Event))
+	data = appendString(data, message.SenderIp)
+	data = binary.AppendVarint(data, int64(message.Order.Floor))
+	data = binary.AppendVarint(data, int64(message.Order.ButtonType))
+	data = appendBits(data, message.Order.Value)
+	data = appendString(data, message.AssignedTo)
+
+	state := message.State
+	data = binary.AppendVarint(data, int64(state.Lastfloor))
+	data = binary.AppendVarint(data, int64(state.Direction))
+	data = appendBits(data, state.Moving, state.OpenDoor, state.OutOfService)
+	data = appendBits(data, state.InternalOrders[:]...)
+	var externalOrders []bool
+	for floor := range state.ExternalOrders {
+		externalOrders = append(externalOrders, state.ExternalOrders[floor][:]...)
+	}
+	data = appendBits(data, externalOrders...)
+
+	// The IPs in the hall orders, then the index of the IP of every hall call, 0 for none.
+	var ips []string
+	indexes := make([]byte, 0, N_FLOORS*(N_BUTTONS-1))
+	for floor := range message.HallOrders {
+		for _, ip := range message.HallOrders[floor] {
+			index := 0
+			for i := range ips {
+				if ips[i] == ip {
+					index = i + 1
+				}
+			}
+			if index == 0 && ip != "" {
+				if len(ips) == 255 {
+					return nil, errors.New("NETWORK:\t Too many IPs in the hall orders.")
+				}
+				ips = append(ips, ip)
+				index = len(ips)
+			}
+			indexes = append(indexes, byte(index))
+		}
+	}
+	data = append(data, byte(len(ips)))
+	for _, ip := range ips {
+		data = appendString(data, ip)
+	}
+	data = append(data, indexes...)
+	data = binary.AppendVarint(data, int64(message.Traffic))
+	data = binary.AppendVarint(data, int64(message.Recall.Number))
+	data = appendBits(data, message.Recall.On)
+	data = binary.AppendVarint(data, int64(state.Service))
+	data = appendBits(data, state.Destinations[:]...)
+	data = binary.AppendVarint(data, int64(message.Call.Origin))
+	data = binary.AppendVarint(data, int64(message.Call.Destination))
+	data = appendString(data, message.Call.Panel)
+	data = binary.AppendVarint(data, int64(message.Call.Number))
+	data = binary.AppendVarint(data, int64(state.Load))
+	data = appendBits(data, state.Full)
+	return data, nil
+}
+
+func (binaryCodec) Unmarshal(data []byte, message *ElevatorMessage) error {
+	reader := binaryReader{data: data}
+	if reader.byte() != binaryCodecID {
+		return errors.New("NETWORK:\t Not a binary packet.")
+	}
+	if version := reader.byte(); version != binaryVersion {
+		return fmt.Errorf("NETWORK:\t A binary packet of version %d, this elevator knows version %d.", version, binaryVersion)
+	}
+	var decoded ElevatorMessage
+	decoded.Event = reader.int()
+	decoded.SenderIp = reader.string()
+	decoded.Order.Floor = reader.int()
+	decoded.Order.ButtonType = reader.int()
+	reader.bits(&decoded.Order.Value)
+	decoded.AssignedTo = reader.string()
+
+	state := &decoded.State
+	state.Lastfloor = reader.int()
+	state.Direction = reader.int()
+	reader.bits(&state.Moving, &state.OpenDoor, &state.OutOfService)
+	internalOrders := make([]*bool, N_FLOORS)
+	for floor := range state.InternalOrders {
+		internalOrders[floor] = &state.InternalOrders[floor]
+	}
+	reader.bits(internalOrders...)
+	var externalOrders []*bool
+	for floor := range state.ExternalOrders {
+		for button := range state.ExternalOrders[floor] {
+			externalOrders = append(externalOrders, &state.ExternalOrders[floor][button])
+		}
+	}
+	reader.bits(externalOrders...)
+
+	ips := make([]string, reader.byte())
+	for i := range ips {
+		ips[i] = reader.string()
+	}
+	for floor := range decoded.HallOrders {
+		for button := range decoded.HallOrders[floor] {
+			index := int(reader.byte())
+			if index > len(ips) {
+				return errors.New("NETWORK:\t Bad IP index in a binary packet.")
+			} else if index > 0 {
+				decoded.HallOrders[floor][button] = ips[index-1]
+			}
+		}
+	}
+	decoded.Traffic = reader.int()
+	decoded.Recall.Number = reader.int()
+	reader.bits(&decoded.Recall.On)
+	state.Service = reader.int()
+	destinations := make([]*bool, N_FLOORS)
+	for floor := range state.Destinations {
+		destinations[floor] = &state.Destinations[floor]
+	}
+	reader.bits(destinations...)
+	decoded.Call.Origin = reader.int()
+	decoded.Call.Destination = reader.int()
+	decoded.Call.Panel = reader.string()
+	decoded.Call.Number = reader.int()
+	state.Load = reader.int()
+	reader.bits(&state.Full)
+	if reader.err != nil {
+		return reader.err
+	}
+	if len(reader.data) > 0 {
+		return errors.New("NETWORK:\t Trailing bytes in a binary packet.")
+	}
+	*message = decoded
+	return nil
+}
+
+func appendString(data []byte, s string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(s)))
+	return append(data, s...)
+}
+
+// Appends the bools as bits, eight in each byte.
+func appendBits(data []byte, bits ...bool) []byte {
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8 && i+j < len(bits); j++ {
+			if bits[i+j] {
+				b |= 1 << uint(j)
+			}
+		}
+		data = append(data, b)
+	}
+	return data
+}
+
+// Reads a binary packet. The first error is kept, and then everything reads as zero.
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+func (reader *binaryReader) fail() {
+	if reader.err == nil {
+		reader.err = errors.New("NETWORK:\t Truncated binary packet.")
+	}
+	reader.data = nil
+}
+
+func (reader *binaryReader) byte() byte {
+	if len(reader.data) < 1 {
+		reader.fail()
+		return 0
+	}
+	b := reader.data[0]
+	reader.data = reader.data[1:]
+	return b
+}
+
+func (reader *binaryReader) int() int {
+	value, n := binary.Varint(reader.data)
+	if n <= 0 {
+		reader.fail()
+		return 0
+	}
+	reader.data = reader.data[n:]
+	return int(value)
+}
+
+func (reader *binaryReader) string() string {
+	length, n := binary.Uvarint(reader.data)
+	if n <= 0 || length > uint64(len(reader.data)-n) {
+		reader.fail()
+		return ""
+	}
+	s := string(reader.data[n : n+int(length)])
+	reader.data = reader.data[n+int(length):]
+	return s
+}
+
+func (reader *binaryReader) bits(bits ...*bool) {
+	for i := 0; i < len(bits); i += 8 {
+		b := reader.byte()
+		for j := 0; j < 8 && i+j < len(bits); j++ {
+			*bits[i+j] = b&(1<<uint(j)) != 0
+		}
+	}
+}
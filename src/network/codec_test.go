@@ -0,0 +1,107 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+	. "typedef"
+)
+
+// A typical message: a notify alive with a busy state and hall orders table.
+func testMessage() ElevatorMessage {
+	message := ElevatorMessage{
+		Event:      EventNotifyAlive,
+		SenderIp:   "129.241.187.152",
+		Order:      Order{Floor: 2, ButtonType: BUTTON_CALL_DOWN, Value: true},
+		AssignedTo: "129.241.187.153",
+	}
+	message.State.Lastfloor = 1
+	message.State.Direction = DIR_UP
+	message.State.Moving = true
+	message.State.InternalOrders[3] = true
+	message.State.ExternalOrders[2][BUTTON_CALL_DOWN] = true
+	ips := []string{"129.241.187.152", "129.241.187.153", "129.241.187.161"}
+	for floor := range message.HallOrders {
+		for button := range message.HallOrders[floor] {
+			message.HallOrders[floor][button] = ips[(floor+button)%len(ips)]
+		}
+	}
+	return message
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	busy := testMessage()
+	empty := ElevatorMessage{Event: EventNotifyAlive, SenderIp: "10.0.0.1"}
+	negative := ElevatorMessage{Event: EventNewOrder, SenderIp: "10.0.0.1", Order: Order{Floor: -1, ButtonType: BUTTON_COMMAND}}
+	negative.State.Direction = DIR_DOWN
+	destination := ElevatorMessage{Event: EventDestinationConfirmed, SenderIp: "10.0.0.2", Call: DestinationCall{Origin: 3, Destination: 0, Panel: "10.0.0.100", Number: 7}}
+	for _, codec := range []Codec{JSON, Binary} {
+		for name, message := range map[string]ElevatorMessage{"busy": busy, "empty": empty, "negative": negative, "destination": destination} {
+			data, err := codec.Marshal(message)
+			if err != nil {
+				t.Fatalf("%s: Marshal(%s): %v", codec.Name(), name, err)
+			}
+			var decoded ElevatorMessage
+			if err := decode(data, &decoded); err != nil {
+				t.Fatalf("%s: decode(%s): %v", codec.Name(), name, err)
+			}
+			if decoded != message {
+				t.Errorf("%s: %s decoded as %+v, want %+v", codec.Name(), name, decoded, message)
+			}
+		}
+	}
+}
+
+func TestBinaryRejectsBrokenPackets(t *testing.T) {
+	data, err := Binary.Marshal(testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ElevatorMessage
+	for length := 1; length < len(data); length++ {
+		if err := Binary.Unmarshal(data[:length], &decoded); err == nil {
+			t.Errorf("a packet cut to %d of %d bytes decoded", length, len(data))
+		}
+	}
+	if err := Binary.Unmarshal(append(data, 0), &decoded); err == nil {
+		t.Error("a packet with a trailing byte decoded")
+	}
+	if err := decode([]byte{0xff}, &decoded); err == nil {
+		t.Error("a packet of an unknown codec decoded")
+	}
+	data[1]++
+	if err := Binary.Unmarshal(data, &decoded); err == nil {
+		t.Error("a packet of another version decoded")
+	}
+}
+
+// Compares the size of the packets of the codecs, and the time and memory it takes to encode and decode them.
+func BenchmarkCodecs(b *testing.B) {
+	message := testMessage()
+	for _, codec := range []Codec{JSON, Binary} {
+		data, err := codec.Marshal(message)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var decoded ElevatorMessage
+		if err := decode(data, &decoded); err != nil {
+			b.Fatal(err)
+		}
+		if reencoded, _ := codec.Marshal(decoded); !bytes.Equal(reencoded, data) {
+			b.Fatalf("the %s codec does not decode what it encodes", codec.Name())
+		}
+		b.Run(codec.Name()+"/encode", func(b *testing.B) {
+			b.ReportAllocs()
+			b.ReportMetric(float64(len(data)), "bytes/packet")
+			for i := 0; i < b.N; i++ {
+				codec.Marshal(message)
+			}
+		})
+		b.Run(codec.Name()+"/decode", func(b *testing.B) {
+			b.ReportAllocs()
+			b.ReportMetric(float64(len(data)), "bytes/packet")
+			for i := 0; i < b.N; i++ {
+				decode(data, &decoded)
+			}
+		})
+	}
+}
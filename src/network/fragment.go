@@ -0,0 +1,154 @@
+package network
+
+/*
+	Messages bigger than the max packet size are split into fragments, which
+	are put together again by the receiver. A fragment is labeled like the
+	packets of the codecs (see codec.go):
+		| fragmentLabel | message ID (uvarint) | index | count | part of the packet |
+	The message ID is counted up by the sender for every message it splits,
+	and the fragments are told apart by the sender's address and the ID.
+	A message which is not complete within reassemblyTimeout of its first
+	fragment is thrown away, as is the oldest one when there are too many.
+	A message can have at most maxFragments fragments, bigger ones are not
+	sent. A fragment always has a part of the packet, so an empty one is
+	malformed.
+*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const fragmentLabel = 2
+const maxFragments = 64
+const fragmentHeaderSize = 1 + binary.MaxVarintLen32 + 2
+const reassemblyTimeout = time.Second
+const maxPartialMessages = 32
+
+// Below the MTU of ethernet, with room for the header of the Authenticator.
+const DefaultMaxPacketSize = 1200
+
+/*
+	Splits the packet into fragments no bigger than maxPacketSize. A packet
+	which fits is returned as it is. It is an error if it needs more than
+	maxFragments fragments.
+*/
+func fragment(packet []byte, messageID uint32, maxPacketSize int) ([][]byte, error) {
+	if len(packet) <= maxPacketSize {
+		return [][]byte{packet}, nil
+	}
+	partSize := maxPacketSize - fragmentHeaderSize
+	if partSize <= 0 {
+		return nil, fmt.Errorf("NETWORK:\t The max packet size %d is too small for fragments.", maxPacketSize)
+	}
+	count := (len(packet) + partSize - 1) / partSize
+	if count > maxFragments {
+		return nil, fmt.Errorf("NETWORK:\t The message of %d bytes is bigger than the limit of %d bytes.", len(packet), maxFragments*partSize)
+	}
+	fragments := make([][]byte, 0, count)
+	for index := 0; index < count; index++ {
+		part := packet[index*partSize:]
+		if len(part) > partSize {
+			part = part[:partSize]
+		}
+		fragment := make([]byte, 0, fragmentHeaderSize+len(part))
+		fragment = append(fragment, fragmentLabel)
+		fragment = binary.AppendUvarint(fragment, uint64(messageID))
+		fragment = append(fragment, byte(index), byte(count))
+		fragment = append(fragment, part...)
+		fragments = append(fragments, fragment)
+	}
+	return fragments, nil
+}
+
+func isFragment(packet []byte) bool {
+	return len(packet) > 0 && packet[0] == fragmentLabel
+}
+
+// Puts the fragments from all the senders together again.
+type reassembler struct {
+	partial map[partialKey]*partialMessage
+}
+
+type partialKey struct {
+	sender    string
+	messageID uint32
+}
+
+type partialMessage struct {
+	fragments [][]byte
+	have      uint64 // A bit for each index which has arrived, maxFragments at most.
+	received  int
+	started   time.Time
+}
+
+func newReassembler() *reassembler {
+	return &reassembler{partial: make(map[partialKey]*partialMessage)}
+}
+
+/*
+	Adds a fragment from the sender, and returns the packet it was part of
+	when all its fragments have arrived.
+*/
+func (r *reassembler) add(sender string, fragment []byte, now time.Time) (packet []byte, complete bool, err error) {
+	messageID, n := binary.Uvarint(fragment[1:])
+	if n <= 0 || messageID > uint64(^uint32(0)) || len(fragment) <= 1+n+2 {
+		return nil, false, errors.New("NETWORK:\t Malformed fragment.")
+	}
+	index, count := int(fragment[1+n]), int(fragment[1+n+1])
+	if count < 2 || count > maxFragments || index >= count {
+		return nil, false, fmt.Errorf("NETWORK:\t Bad fragment %d of %d.", index, count)
+	}
+	key := partialKey{sender: sender, messageID: uint32(messageID)}
+	message, ok := r.partial[key]
+	if !ok {
+		if len(r.partial) >= maxPartialMessages {
+			r.dropOldest()
+		}
+		message = &partialMessage{fragments: make([][]byte, count), started: now}
+		r.partial[key] = message
+	}
+	if len(message.fragments) != count {
+		delete(r.partial, key)
+		return nil, false, fmt.Errorf("NETWORK:\t Fragments of message %d from %s disagree on the count.", messageID, sender)
+	}
+	if message.have&(1<<uint(index)) != 0 {
+		return nil, false, nil // A duplicate.
+	}
+	message.fragments[index] = append([]byte(nil), fragment[1+n+2:]...)
+	message.have |= 1 << uint(index)
+	message.received++
+	if message.received < count {
+		return nil, false, nil
+	}
+	delete(r.partial, key)
+	for _, part := range message.fragments {
+		packet = append(packet, part...)
+	}
+	return packet, true, nil
+}
+
+// Throws away the messages which have not been completed in time. Returns how many.
+func (r *reassembler) cleanup(now time.Time) int {
+	dropped := 0
+	for key, message := range r.partial {
+		if now.Sub(message.started) > reassemblyTimeout {
+			delete(r.partial, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+func (r *reassembler) dropOldest() {
+	var oldest partialKey
+	var oldestStart time.Time
+	for key, message := range r.partial {
+		if oldestStart.IsZero() || message.started.Before(oldestStart) {
+			oldest, oldestStart = key, message.started
+		}
+	}
+	delete(r.partial, oldest)
+}
@@ -0,0 +1,172 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func testPacket(size int) []byte {
+	packet := make([]byte, size)
+	for i := range packet {
+		packet[i] = byte(i)
+	}
+	return packet
+}
+
+func TestFragment(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		fragments int // 0 if it can not be split.
+	}{
+		{"fits", 100, 1},
+		{"just fits", 200, 1},
+		{"just too big", 201, 2},
+		{"many", 1000, 1000/(200-fragmentHeaderSize) + 1},
+		{"too many", maxFragments*(200-fragmentHeaderSize) + 1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fragments, err := fragment(testPacket(test.size), 7, 200)
+			if test.fragments == 0 {
+				if err == nil {
+					t.Errorf("split into %d fragments, want an error", len(fragments))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fragments) != test.fragments {
+				t.Errorf("split into %d fragments, want %d", len(fragments), test.fragments)
+			}
+			for _, f := range fragments {
+				if len(f) > 200 {
+					t.Errorf("a fragment of %d bytes", len(f))
+				}
+				if len(fragments) > 1 && !isFragment(f) {
+					t.Error("a fragment is not labeled")
+				}
+			}
+		})
+	}
+	if _, err := fragment(testPacket(100), 1, fragmentHeaderSize); err == nil {
+		t.Error("split with no room for the parts")
+	}
+}
+
+func TestReassemble(t *testing.T) {
+	packet := testPacket(1000)
+	fragments, err := fragment(packet, 7, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := len(fragments) - 1
+	tests := []struct {
+		name  string
+		order []int // The fragments in the order they arrive.
+	}{
+		{"in order", []int{0, 1, 2, 3, 4, 5}},
+		{"reversed", []int{5, 4, 3, 2, 1, 0}},
+		{"with duplicates", []int{0, 0, 2, 1, 2, 3, 4, 5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if len(test.order) < len(fragments) {
+				t.Fatalf("the test sends %d of %d fragments", len(test.order), len(fragments))
+			}
+			r := newReassembler()
+			now := time.Now()
+			for i, index := range test.order {
+				reassembled, complete, err := r.add("10.0.0.1", fragments[index], now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i < len(test.order)-1 && complete {
+					t.Fatalf("complete after %d fragments", i+1)
+				}
+				if i == len(test.order)-1 && (!complete || !bytes.Equal(reassembled, packet)) {
+					t.Fatalf("not put together: complete %t, %d bytes", complete, len(reassembled))
+				}
+			}
+			if len(r.partial) != 0 {
+				t.Errorf("%d partial messages left", len(r.partial))
+			}
+		})
+	}
+
+	t.Run("senders kept apart", func(t *testing.T) {
+		r := newReassembler()
+		now := time.Now()
+		for _, f := range fragments[:last] {
+			r.add("10.0.0.1", f, now)
+		}
+		if _, complete, _ := r.add("10.0.0.2", fragments[last], now); complete {
+			t.Error("completed with the fragments of another sender")
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		r := newReassembler()
+		now := time.Now()
+		r.add("10.0.0.1", fragments[0], now)
+		if dropped := r.cleanup(now.Add(reassemblyTimeout / 2)); dropped != 0 {
+			t.Errorf("dropped %d before the timeout", dropped)
+		}
+		if dropped := r.cleanup(now.Add(2 * reassemblyTimeout)); dropped != 1 {
+			t.Errorf("dropped %d after the timeout, want 1", dropped)
+		}
+		for _, f := range fragments[1:] {
+			if _, complete, _ := r.add("10.0.0.1", f, now); complete {
+				t.Error("completed without the fragment thrown away")
+			}
+		}
+	})
+
+	t.Run("too many partial messages", func(t *testing.T) {
+		r := newReassembler()
+		now := time.Now()
+		for id := 0; id <= maxPartialMessages; id++ {
+			f, _ := fragment(packet, uint32(id), 200)
+			r.add("10.0.0.1", f[0], now.Add(time.Duration(id)*time.Millisecond))
+		}
+		if len(r.partial) != maxPartialMessages {
+			t.Errorf("%d partial messages, want %d", len(r.partial), maxPartialMessages)
+		}
+		if _, ok := r.partial[partialKey{sender: "10.0.0.1", messageID: 0}]; ok {
+			t.Error("the oldest message was kept")
+		}
+	})
+}
+
+func TestReassembleRejectsBadFragments(t *testing.T) {
+	fragments, err := fragment(testPacket(1000), 7, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := fragment(testPacket(500), 7, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		fragment []byte
+	}{
+		{"header only", []byte{fragmentLabel}},
+		{"no count", []byte{fragmentLabel, 7, 0}},
+		{"index past the count", []byte{fragmentLabel, 7, 3, 3, 0}},
+		{"one fragment", []byte{fragmentLabel, 7, 0, 1, 0}},
+		{"empty part", []byte{fragmentLabel, 7, 1, 6}},
+		{"other count", other[1]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newReassembler()
+			r.add("10.0.0.1", fragments[0], time.Now())
+			if _, _, err := r.add("10.0.0.1", test.fragment, time.Now()); err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
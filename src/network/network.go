@@ -4,63 +4,150 @@ package network
 	It communicates with other modules through two channels, sendChannel and receiveChannel, which holds the
 	serialized object to send and that wich are received. It uses the UDP protocol to communicate on the 
 	network, and acknowledgement is done on application level.
-	Messages are expected to be Structs which can be zerialized to JSON.
+	Messages are expected to be Structs which can be zerialized to JSON, or another Codec.
 	It uses the UDP module to do the actual networking on the UDP protocol.
 */
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
+	"lifecycle"
 	"log"
-	. "../typedef"
-	"../udp"
+	"strconv"
+	"strings"
+	"time"
+	. "typedef"
+	"udp"
 )
 
 // Constant used to determine output to console-
 const debug = false
 
+// The ports and message size used by Init, and the defaults of the config package.
+const (
+	DefaultMessageSize            = 4 * 1024
+	DefaultUDPLocalListenPort     = 22301
+	DefaultUDPBroadcastListenPort = 22302
+)
+
+// How to send the messages.
+type Config struct {
+	Codec         Codec        // The codec of the sent messages, nil is JSON. Received messages are decoded with the codec they are labeled with.
+	MaxPacketSize int          // Bigger messages are split into fragments, see fragment.go. 0 is DefaultMaxPacketSize.
+	Errors        chan<- error // Where the DecodeErrors are reported, like in the udp module. nil logs them.
+}
+
+// A received packet or fragment which could not be decoded. It is dropped.
+type DecodeError struct {
+	Sender string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("NETWORK:\t Could not decode a message from %s: %s", e.Sender, strings.TrimPrefix(e.Err.Error(), "NETWORK:\t "))
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
 /* 
 	This function initializes the network module, based on the channel passed from the calling module.
 	It returns this systems/modules ip on the local network or, if any, error. 
-	It sets the hardcoded ports for listening and broadcast ports, and makes two corresponding UDPMessage channels
+	It sets the default ports for listening and broadcast ports, and makes two corresponding UDPMessage channels
 	for sending and receiving. It calls the init function from the udp module to set up the udp connection.
 */
-func Init(receiveChannel chan<- SomeStructToPassOnNetwork,
-	sendChannel <-chan SomeStructToPassOnNetwork) (localIP string, err error) {
-	const messageSize = 4 * 1024
-	const UDPLocalListenPort = 22301
-	const UDPBroadcastListenPort = 22302
+func Init(receiveChannel chan<- ElevatorMessage,
+	sendChannel <-chan ElevatorMessage) (localIP string, err error) {
+	config := udp.Config{LocalListenPort: DefaultUDPLocalListenPort, BroadcastListenPort: DefaultUDPBroadcastListenPort, MessageSize: DefaultMessageSize}
+	return InitTransport(udp.ConfigTransport(config), receiveChannel, sendChannel)
+}
+
+/*
+	Initializes the network module on the given transport instead of the UDP sockets, for example
+	an udp.Bus when several elevators run in the same process.
+*/
+func InitTransport(transport udp.Transport, receiveChannel chan<- ElevatorMessage,
+	sendChannel <-chan ElevatorMessage) (localIP string, err error) {
+	return InitConfig(transport, Config{}, receiveChannel, sendChannel)
+}
+
+// Initializes the network module on the given transport, with the config. It runs forever.
+func InitConfig(transport udp.Transport, config Config, receiveChannel chan<- ElevatorMessage,
+	sendChannel <-chan ElevatorMessage) (localIP string, err error) {
+	localIP, _, err = Start(context.Background(), transport, config, receiveChannel, sendChannel)
+	return localIP, err
+}
+
+/*
+	Starts the network module on the given transport, with the config. It runs until the context
+	is done or the handle is closed. Then the messages left on the sendChannel are sent before the
+	transport is stopped.
+*/
+func Start(ctx context.Context, transport udp.Transport, config Config, receiveChannel chan<- ElevatorMessage,
+	sendChannel <-chan ElevatorMessage) (localIP string, handle *lifecycle.Handle, err error) {
+	if config.Codec == nil {
+		config.Codec = JSON
+	}
+	if config.MaxPacketSize == 0 {
+		config.MaxPacketSize = DefaultMaxPacketSize
+	}
 	UDPSendChannel := make(chan udp.UDPMessage, 10)
 	UDPReceiveChannel := make(chan udp.UDPMessage)
-	localIP, err = udp.Init(UDPLocalListenPort, UDPBroadcastListenPort, messageSize, UDPSendChannel, UDPReceiveChannel)
+	handle, ctx = lifecycle.New(ctx)
+	localIP, err = udp.StartNext(ctx, handle, transport, UDPSendChannel, UDPReceiveChannel)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	go receiveMessageHandler(receiveChannel, UDPReceiveChannel)
-	go sendMessageHandler(sendChannel, UDPSendChannel)
-	return localIP, nil
+	handle.Go(func() { receiveMessageHandler(ctx, config.Errors, receiveChannel, UDPReceiveChannel) })
+	handle.Go(func() { sendMessageHandler(ctx, config, sendChannel, UDPSendChannel) })
+	return localIP, handle, nil
 }
 
 /*
 	This handle takes care of received messages on the connectionport or broadcastport.
 	It takes in the receiveChannel initialized in the calling module and the UDPReceiveChannel declared in 
-	this modules Init function. We send the message in JSON format and prints an error if the unmarshaling failed.
-	Per 7/2-16 it prints the message directly to console, but in elevator context it should pass the received message
-	to the main module.(Make generic interface which supports extracting received messages.)
+	this modules Init function. The message is decoded with the codec it is labeled with, and a DecodeError is reported if it failed.
 	The receive channel is where these messages are passed to the calling module.
+	Fragments are kept until the rest of their message has arrived. It stops when the context is done.
 */
-func receiveMessageHandler(receiveChannel chan<- SomeStructToPassOnNetwork, UDPReceiveChannel <-chan udp.UDPMessage) {
+func receiveMessageHandler(ctx context.Context, errorChannel chan<- error, receiveChannel chan<- ElevatorMessage, UDPReceiveChannel <-chan udp.UDPMessage) {
+	reassembler := newReassembler()
+	cleanupTicker := time.NewTicker(reassemblyTimeout)
+	defer cleanupTicker.Stop()
 	for {
 		select {
+		case <-ctx.Done():
+			return
+		case <-cleanupTicker.C:
+			if dropped := reassembler.cleanup(time.Now()); dropped > 0 {
+				printDebug("Dropped " + strconv.Itoa(dropped) + " incomplete messages.")
+			}
 		case message := <-UDPReceiveChannel:
-			var f interface{}
-			err := json.Unmarshal(message.Data[:message.Length], &f)
+			packet := message.Data[:message.Length]
+			if isFragment(packet) {
+				var complete bool
+				var err error
+				packet, complete, err = reassembler.add(message.RAddress, packet, time.Now())
+				if err != nil {
+					lifecycle.Report(errorChannel, &DecodeError{Sender: message.RAddress, Err: err})
+				}
+				if !complete {
+					message.Release() // The reassembler keeps a copy.
+					continue
+				}
+			}
+			var elevatorMessage ElevatorMessage
+			err := decode(packet, &elevatorMessage)
+			message.Release()
 			if err != nil {
 				printDebug("Error with Unmarshaling a message.")
-				log.Println(err)
+				lifecycle.Report(errorChannel, &DecodeError{Sender: message.RAddress, Err: err})
 			} else {
-				m := f.(map[string]interface{})
-				message := string(m["Message"].(string))
-				log.Println("ReceiveMessageHandler:\t ", message, " from ", string(m["SenderIp"].(string)))
+				printDebug("Received a message from " + elevatorMessage.SenderIp)
+				select {
+				case receiveChannel <- elevatorMessage:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
 	}
@@ -68,23 +155,39 @@ func receiveMessageHandler(receiveChannel chan<- SomeStructToPassOnNetwork, UDPR
 /*
 	This handle takes care of sending messages on the connectionport or broadcastport.
 	It takes in the sendChannel initialized in the calling module and the UDPSendChannel declared in 
-	this modules Init function. We send the message in JSON format and prints an error if the marshaling failed.
+	this modules Init function. We send the message with the codec and prints an error if the marshaling failed.
+	Messages bigger than the max packet size are sent as fragments, and an error is printed if they are too big for that.
+	When the context is done, the messages left on the sendChannel are sent before it returns.
 */
-func sendMessageHandler(sendChannel <-chan SomeStructToPassOnNetwork, UDPSendChannel chan<- udp.UDPMessage) {
+func sendMessageHandler(ctx context.Context, config Config, sendChannel <-chan ElevatorMessage, UDPSendChannel chan<- udp.UDPMessage) {
+	messageID := uint32(time.Now().UnixNano())
 	for {
-		log.Println("Network:\t SendmessageHandler")
+		var message ElevatorMessage
 		select {
-		case message := <-sendChannel:
-			networkPacket, err := json.Marshal(message)
-			if err != nil {
-				printDebug("Error Marshalling an outgoing message")
-				log.Println(err)
-			} else {
-				UDPSendChannel <- udp.UDPMessage{RAddress: "broadcast", Data: networkPacket}
-				temp := "Sent a message with content: " + message.Message
-				printDebug(temp)
+		case message = <-sendChannel:
+		case <-ctx.Done():
+			select {
+			case message = <-sendChannel:
+			default:
+				return
 			}
 		}
+		networkPacket, err := config.Codec.Marshal(message)
+		if err != nil {
+			printDebug("Error Marshalling an outgoing message")
+			log.Println(err)
+			continue
+		}
+		messageID++
+		fragments, err := fragment(networkPacket, messageID, config.MaxPacketSize)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		for _, packet := range fragments {
+			UDPSendChannel <- udp.UDPMessage{RAddress: "broadcast", Data: packet}
+		}
+		printDebug("Sent a message with event: " + strconv.Itoa(message.Event))
 	}
 }
 
@@ -0,0 +1,201 @@
+package node
+
+/*
+	This module starts one complete networked elevator: the hardware, elevator,
+	network and group modules, and the channels between them.
+	The hardware is given as an IODevice and the network as an udp.Transport,
+	so the same elevator runs on the lab elevators with the comedi driver and
+	the UDP sockets, or in the test harness with a simulated elevator on an
+	udp.Bus.
+	When the context is done or Close is called the modules are stopped one by
+	one, so each can finish talking to the next: the elevator saves its cab
+	orders, the hardware stops the motor, the group tells the others it is
+	leaving, and the network sends what is left and closes the sockets.
+*/
+
+import (
+	"context"
+	"elevator"
+	"group"
+	"hardware"
+	"lifecycle"
+	"network"
+	"sync"
+	"time"
+	"traffic"
+	"typedef"
+	"udp"
+)
+
+// A running elevator.
+type Node struct {
+	IP      string
+	mutex   sync.Mutex
+	state   typedef.ElevatorState
+	handle  *lifecycle.Handle
+	service chan<- int
+	done    <-chan struct{}
+}
+
+// An order served by the elevator, and when it was served.
+type ServedOrder struct {
+	typedef.Order
+	At time.Time
+}
+
+// How to run an elevator, a section for each module.
+type Config struct {
+	Hardware hardware.Config
+	Elevator elevator.Config
+	Network  network.Config
+	Traffic  traffic.Config    // For the group module, which parks the cars by the parking policy of the elevator.
+	Served   func(ServedOrder) // Called with every order the elevator serves, from a goroutine of the node. nil for none.
+}
+
+/*
+	Starts an elevator on the given hardware and network. It returns when the
+	elevator is at a floor and running, and runs until the context is done or
+	Close is called.
+*/
+func Start(ctx context.Context, io hardware.IODevice, transport udp.Transport, config Config) (*Node, error) {
+	buttonChannel := make(chan hardware.ButtonEvent, 10)
+	lightChannel := make(chan hardware.LightEvent, 10)
+	motorChannel := make(chan hardware.MotorEvent, 1)
+	floorChannel := make(chan hardware.FloorEvent, 1)
+	faultChannel := make(chan hardware.FaultEvent, 1)
+	loadChannel := make(chan int, 1)
+	parkChannel := make(chan int, 1)
+	recallSwitchChannel := make(chan bool, 10)
+	recallChannel := make(chan bool, 10)
+	serviceChannel := make(chan int, 10)
+	destinationChannel := make(chan typedef.DestinationCall, 10)
+	hallCallChannel := make(chan typedef.Order, 2*typedef.N_FLOORS)
+	assignChannel := make(chan typedef.Order, 2*typedef.N_FLOORS)
+	doneChannel := make(chan typedef.Order, 2*typedef.N_FLOORS)
+	elevatorStateChannel := make(chan typedef.ElevatorState, 1)
+	groupStateChannel := make(chan typedef.ElevatorState, 1)
+	var servedChannel chan typedef.Order // Only with a Served hook.
+	if config.Served != nil {
+		servedChannel = make(chan typedef.Order, 2*typedef.N_FLOORS)
+	}
+	receiveChannel := make(chan typedef.ElevatorMessage, 10)
+	sendChannel := make(chan typedef.ElevatorMessage, 10)
+
+	// The modules are not stopped by the context, but one by one when the node is.
+	handle, ctx := lifecycle.New(ctx)
+	modulesCtx := context.WithoutCancel(ctx)
+	localIP, networkHandle, err := network.Start(modulesCtx, transport, config.Network, receiveChannel, sendChannel)
+	if err != nil {
+		handle.Close()
+		return nil, err
+	}
+	config.Hardware.Faults = faultChannel
+	config.Hardware.Load = loadChannel
+	config.Elevator.PeakIdleTime = config.Traffic.IdleTime
+	hardwareHandle, err := hardware.New(io).Start(modulesCtx, buttonChannel, lightChannel, motorChannel, floorChannel, config.Hardware)
+	if err != nil {
+		networkHandle.Close()
+		handle.Close()
+		return nil, err
+	}
+	elevatorHandle := elevator.Start(modulesCtx, elevator.Channels{
+		Button:       buttonChannel,
+		Light:        lightChannel,
+		Motor:        motorChannel,
+		Floor:        floorChannel,
+		HallCall:     hallCallChannel,
+		Assign:       assignChannel,
+		Done:         doneChannel,
+		State:        elevatorStateChannel,
+		Served:       servedChannel,
+		Fault:        faultChannel,
+		Park:         parkChannel,
+		RecallSwitch: recallSwitchChannel,
+		Recall:       recallChannel,
+		Service:      serviceChannel,
+		Destination:  destinationChannel,
+		Load:         loadChannel,
+	}, config.Elevator)
+	groupHandle := group.Start(modulesCtx, localIP, group.Channels{
+		Send:         sendChannel,
+		Receive:      receiveChannel,
+		HallCall:     hallCallChannel,
+		Done:         doneChannel,
+		State:        groupStateChannel,
+		Assign:       assignChannel,
+		Light:        lightChannel,
+		Park:         parkChannel,
+		RecallSwitch: recallSwitchChannel,
+		Recall:       recallChannel,
+		Service:      serviceChannel,
+		Destination:  destinationChannel,
+	}, group.Config{Parking: config.Elevator.Parking, Traffic: config.Traffic})
+	node := &Node{IP: localIP, handle: handle, service: serviceChannel, done: ctx.Done()}
+	handle.Cleanup(func() {
+		elevatorHandle.Close()
+		hardwareHandle.Close()
+		groupHandle.Close()
+		networkHandle.Close()
+	})
+	handle.Go(func() { node.forwardState(ctx, elevatorStateChannel, groupStateChannel) })
+	if config.Served != nil {
+		handle.Go(func() { recordServed(ctx, servedChannel, config.Served) })
+	}
+	return node, nil
+}
+
+// Stops the elevator, and waits until it has stopped.
+func (node *Node) Close() {
+	node.handle.Close()
+}
+
+// Waits until the elevator has stopped, after the context is done or Close is called.
+func (node *Node) Wait() {
+	node.handle.Wait()
+}
+
+// Returns the latest state of the elevator.
+func (node *Node) State() typedef.ElevatorState {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+	return node.state
+}
+
+// Puts the elevator in a service mode, like the EventService command does.
+func (node *Node) SetService(mode int) {
+	select {
+	case node.service <- mode:
+	case <-node.done:
+	}
+}
+
+func recordServed(ctx context.Context, servedChannel <-chan typedef.Order, served func(ServedOrder)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case order := <-servedChannel:
+			served(ServedOrder{Order: order, At: time.Now()})
+		}
+	}
+}
+
+// Keeps a copy of the elevator's state, and passes it on to the group.
+func (node *Node) forwardState(ctx context.Context, elevatorStateChannel <-chan typedef.ElevatorState, groupStateChannel chan typedef.ElevatorState) {
+	for {
+		var state typedef.ElevatorState
+		select {
+		case <-ctx.Done():
+			return
+		case state = <-elevatorStateChannel:
+		}
+		node.mutex.Lock()
+		node.state = state
+		node.mutex.Unlock()
+		select {
+		case <-groupStateChannel:
+		default:
+		}
+		groupStateChannel <- state
+	}
+}
@@ -0,0 +1,171 @@
+package parking
+
+/*
+	This module decides where the cars without orders wait. A car which has
+	had no orders for the idle time drives to its park floor, so the next
+	passenger does not have to wait for it to come from the other end of the
+	building.
+	The park floors are one for each zone of the building, the home floor
+	first. When several cars are idle the first floor gets the car nearest to
+	it, the second floor the nearest of the rest, and so on, and the cars left
+	over stay where they are. Every elevator in a group makes the same plan
+	from the states it shares, so the cars spread over the zones instead of
+	all parking at the home floor.
+	A schedule gives other park floors at a time of the day, for example the
+	lobby in the morning when everyone arrives.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"typedef"
+)
+
+type Policy struct {
+	IdleTime  time.Duration // How long a car waits without orders before it parks. 0 does not park.
+	Floors    []int         // The park floors, the home floor first.
+	Schedules []Schedule    // Other park floors at times of the day, the first which matches is used.
+}
+
+// The park floors in a period of the day.
+type Schedule struct {
+	Period
+	Floors []int
+}
+
+// Between two times of the day, given from midnight. A To before From is past midnight.
+type Period struct {
+	From time.Duration
+	To   time.Duration
+}
+
+// Whether the time is in the period.
+func (period Period) Contains(now time.Time) bool {
+	year, month, day := now.Date()
+	clock := now.Sub(time.Date(year, month, day, 0, 0, 0, 0, now.Location()))
+	if period.From <= period.To {
+		return clock >= period.From && clock < period.To
+	}
+	return clock >= period.From || clock < period.To
+}
+
+// The park floors at the time.
+func (policy Policy) FloorsAt(now time.Time) []int {
+	for _, schedule := range policy.Schedules {
+		if schedule.Contains(now) {
+			return schedule.Floors
+		}
+	}
+	return policy.Floors
+}
+
+/*
+	Plans where the idle cars park at the time. The cars are given by ip with
+	the floor they are at, and the plan has the park floor of every car which
+	should park. The same cars give the same plan, ties are broken by the
+	lowest ip.
+*/
+func (policy Policy) Plan(now time.Time, cars map[string]int) map[string]int {
+	ips := make([]string, 0, len(cars))
+	for ip := range cars {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	plan := make(map[string]int)
+	for _, floor := range policy.FloorsAt(now) {
+		best := ""
+		for _, ip := range ips {
+			if _, planned := plan[ip]; planned {
+				continue
+			}
+			if best == "" || distance(cars[ip], floor) < distance(cars[best], floor) {
+				best = ip
+			}
+		}
+		if best == "" {
+			break
+		}
+		plan[best] = floor
+	}
+	return plan
+}
+
+func distance(a, b int) int {
+	if a < b {
+		return b - a
+	}
+	return a - b
+}
+
+// ------------------------ Written in the config ------------------------------
+
+// Reads the park floors written like "0,2".
+func ParseFloors(s string) ([]int, error) {
+	var floors []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		floor, err := strconv.Atoi(field)
+		if err != nil || floor < 0 || floor >= typedef.N_FLOORS {
+			return nil, fmt.Errorf("PARKING:\t There is no floor %q.", field)
+		}
+		floors = append(floors, floor)
+	}
+	return floors, nil
+}
+
+// Reads the schedules written like "07:00-10:00=0; 16:00-18:30=3,1".
+func ParseSchedules(s string) ([]Schedule, error) {
+	var schedules []Schedule
+	for _, field := range strings.Split(s, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		period, floors, found := strings.Cut(field, "=")
+		if !found {
+			return nil, fmt.Errorf("PARKING:\t The schedule %q is not written like 07:00-10:00=0.", field)
+		}
+		var schedule Schedule
+		var err error
+		if schedule.Period, err = ParsePeriod(period); err != nil {
+			return nil, err
+		}
+		if schedule.Floors, err = ParseFloors(floors); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+// Reads a period written like "07:00-10:00".
+func ParsePeriod(s string) (Period, error) {
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		return Period{}, fmt.Errorf("PARKING:\t The period %q is not written like 07:00-10:00.", strings.TrimSpace(s))
+	}
+	var period Period
+	var err error
+	if period.From, err = parseClock(from); err != nil {
+		return Period{}, err
+	}
+	if period.To, err = parseClock(to); err != nil {
+		return Period{}, err
+	}
+	return period, nil
+}
+
+// "07:30" is 7.5 hours.
+func parseClock(s string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("PARKING:\t The time %q is not written like 07:30.", strings.TrimSpace(s))
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
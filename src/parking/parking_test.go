@@ -0,0 +1,119 @@
+package parking
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A time on the day of the test at the clock, given from midnight.
+func at(clock time.Duration) time.Time {
+	return time.Date(2016, time.February, 13, 0, 0, 0, 0, time.Local).Add(clock)
+}
+
+func TestPeriodContains(t *testing.T) {
+	morning := Period{From: 7 * time.Hour, To: 10 * time.Hour}
+	night := Period{From: 22 * time.Hour, To: 6 * time.Hour}
+	tests := []struct {
+		name   string
+		period Period
+		clock  time.Duration
+		want   bool
+	}{
+		{"before", morning, 6*time.Hour + 59*time.Minute, false},
+		{"at the start", morning, 7 * time.Hour, true},
+		{"inside", morning, 8*time.Hour + 30*time.Minute, true},
+		{"at the end", morning, 10 * time.Hour, false},
+		{"after", morning, 15 * time.Hour, false},
+		{"before midnight", night, 23 * time.Hour, true},
+		{"at midnight", night, 0, true},
+		{"after midnight", night, 5*time.Hour + 59*time.Minute, true},
+		{"at the end past midnight", night, 6 * time.Hour, false},
+		{"in the day between", night, 12 * time.Hour, false},
+		{"at the start before midnight", night, 22 * time.Hour, true},
+		{"empty", Period{From: 7 * time.Hour, To: 7 * time.Hour}, 7 * time.Hour, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.period.Contains(at(test.clock)); got != test.want {
+				t.Errorf("%+v contains %v: %t, want %t", test.period, test.clock, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseSchedules(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []Schedule
+		wantErr bool
+	}{
+		{"none", "", nil, false},
+		{"one", "07:00-10:00=0", []Schedule{{Period{7 * time.Hour, 10 * time.Hour}, []int{0}}}, false},
+		{"two with spaces", " 07:00-10:00 = 0 ; 16:00-18:30=3, 1 ", []Schedule{
+			{Period{7 * time.Hour, 10 * time.Hour}, []int{0}},
+			{Period{16 * time.Hour, 18*time.Hour + 30*time.Minute}, []int{3, 1}},
+		}, false},
+		{"past midnight", "22:00-06:00=0", []Schedule{{Period{22 * time.Hour, 6 * time.Hour}, []int{0}}}, false},
+		{"trailing semicolon", "07:00-10:00=0;", []Schedule{{Period{7 * time.Hour, 10 * time.Hour}, []int{0}}}, false},
+		{"no floors", "07:00-10:00", nil, true},
+		{"no period", "=0", nil, true},
+		{"no dash", "07:00=0", nil, true},
+		{"bad clock", "7-10=0", nil, true},
+		{"hour too big", "25:00-10:00=0", nil, true},
+		{"no such floor", "07:00-10:00=4", nil, true},
+		{"not a floor", "07:00-10:00=lobby", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedules, err := ParseSchedules(test.s)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ParseSchedules(%q) = %+v, want an error", test.s, schedules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSchedules(%q): %v", test.s, err)
+			}
+			if !reflect.DeepEqual(schedules, test.want) {
+				t.Errorf("ParseSchedules(%q) = %+v, want %+v", test.s, schedules, test.want)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	policy := Policy{
+		IdleTime:  time.Second,
+		Floors:    []int{0, 2},
+		Schedules: []Schedule{{Period{7 * time.Hour, 10 * time.Hour}, []int{0, 0}}},
+	}
+	tests := []struct {
+		name  string
+		clock time.Duration
+		cars  map[string]int
+		want  map[string]int
+	}{
+		{"no cars", 12 * time.Hour, map[string]int{}, map[string]int{}},
+		{"one car goes home", 12 * time.Hour, map[string]int{"10.0.0.1": 3}, map[string]int{"10.0.0.1": 0}},
+		{"nearest car to each floor", 12 * time.Hour, map[string]int{"10.0.0.1": 3, "10.0.0.2": 1},
+			map[string]int{"10.0.0.2": 0, "10.0.0.1": 2}},
+		{"home floor first", 12 * time.Hour, map[string]int{"10.0.0.1": 2, "10.0.0.2": 3},
+			map[string]int{"10.0.0.1": 0, "10.0.0.2": 2}},
+		{"ties to the lowest ip", 12 * time.Hour, map[string]int{"10.0.0.2": 1, "10.0.0.1": 1},
+			map[string]int{"10.0.0.1": 0, "10.0.0.2": 2}},
+		{"cars left over stay", 12 * time.Hour, map[string]int{"10.0.0.1": 0, "10.0.0.2": 2, "10.0.0.3": 3},
+			map[string]int{"10.0.0.1": 0, "10.0.0.2": 2}},
+		{"scheduled floors", 8 * time.Hour, map[string]int{"10.0.0.1": 3, "10.0.0.2": 2, "10.0.0.3": 1},
+			map[string]int{"10.0.0.3": 0, "10.0.0.2": 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if plan := policy.Plan(at(test.clock), test.cars); !reflect.DeepEqual(plan, test.want) {
+				t.Errorf("Plan(%v, %v) = %v, want %v", test.clock, test.cars, plan, test.want)
+			}
+		})
+	}
+}
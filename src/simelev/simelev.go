@@ -0,0 +1,381 @@
+package simelev
+
+/*
+	This module is a simulated elevator, used instead of the comedi driver when
+	there is no elevator hardware available. It is a Go version of the simulator
+	backend in /simulator (sim_backend.d), so it runs in the same process as the
+	elevator and there can be many of them at once.
+	It implements the IODevice interface of the hardware module on the same
+	channels as the IO card. The car moves while the motor is running, and the
+	floor sensors, buttons, lamps and motor can be read back like on the real
+	elevator. The functions Press, SetStop, SetObstruction, SetRecallSwitch
+	and SetLoad are used instead of the keyboard of sim_frontend.d, and
+	FlipLamp and ResetIO make the faults of the IO card: a lamp which
+	drifts, and a reset which clears the outputs and ignores them until the
+	card is initialized again.
+	The car has a load sensor, which reads the weight of the passengers and
+	the load set by SetLoad in kg. A hall button pressed is a passenger
+	waiting at the floor, who gets on when the door opens there, and a cab
+	button pressed is where a passenger who got on and has not pressed one
+	yet is going. The other cab presses are by someone already going
+	somewhere, like a kid pressing every button. The passengers get off when
+	the door opens at their floor, and the ones who never pressed a cab
+	button at the next floor the door opens at.
+*/
+
+import (
+	"hardware"
+	"log"
+	"sync"
+	"time"
+	"typedef"
+)
+
+const debug = false
+
+// The analog motor value which moves the car at the configured travel time.
+const nominalMotorSpeed = 2800
+
+// The timing of the simulated elevator, the same as in simulator.con.
+type Config struct {
+	TravelTimeBetweenFloors time.Duration
+	TravelTimePassingFloor  time.Duration // How long the floor sensor is active when passing a floor.
+	ButtonDepressedTime     time.Duration // How long a pressed button reads as pressed.
+	StartFloor              float64       // Start position of the car, may be between floors.
+	PassengerWeight         int           // In kg.
+}
+
+var DefaultConfig = Config{
+	TravelTimeBetweenFloors: 1500 * time.Millisecond,
+	TravelTimePassingFloor:  650 * time.Millisecond,
+	ButtonDepressedTime:     200 * time.Millisecond,
+	StartFloor:              0,
+	PassengerWeight:         75,
+}
+
+var buttonChannelMatrix = [typedef.N_FLOORS][typedef.N_BUTTONS]int{
+	{hardware.BUTTON_UP1, hardware.BUTTON_DOWN1, hardware.BUTTON_COMMAND1},
+	{hardware.BUTTON_UP2, hardware.BUTTON_DOWN2, hardware.BUTTON_COMMAND2},
+	{hardware.BUTTON_UP3, hardware.BUTTON_DOWN3, hardware.BUTTON_COMMAND3},
+	{hardware.BUTTON_UP4, hardware.BUTTON_DOWN4, hardware.BUTTON_COMMAND4},
+}
+
+var lightChannelMatrix = [typedef.N_FLOORS][typedef.N_BUTTONS]int{
+	{hardware.LIGHT_UP1, hardware.LIGHT_DOWN1, hardware.LIGHT_COMMAND1},
+	{hardware.LIGHT_UP2, hardware.LIGHT_DOWN2, hardware.LIGHT_COMMAND2},
+	{hardware.LIGHT_UP3, hardware.LIGHT_DOWN3, hardware.LIGHT_COMMAND3},
+	{hardware.LIGHT_UP4, hardware.LIGHT_DOWN4, hardware.LIGHT_COMMAND4},
+}
+
+var floorSensors = [typedef.N_FLOORS]int{
+	hardware.SENSOR_FLOOR1, hardware.SENSOR_FLOOR2, hardware.SENSOR_FLOOR3, hardware.SENSOR_FLOOR4,
+}
+
+// One simulated elevator. The position is updated every time the elevator is read or written.
+type Elevator struct {
+	mutex       sync.Mutex
+	config      Config
+	position    float64 // In floors, 0 is the bottom floor.
+	lastUpdate  time.Time
+	outputs     map[int]bool
+	motorSpeed  int
+	buttons     map[int]time.Time // Pressed buttons and the time they are released.
+	stop        bool
+	obstruction bool
+	recall      bool // The fire recall key switch.
+	powered     bool
+	reset       bool                  // The IO card has been reset, and ignores the outputs until Init.
+	jammed      bool                  // The motor runs, but the car does not move.
+	waiting     [typedef.N_FLOORS]int // The passengers waiting at each floor.
+	riding      [typedef.N_FLOORS]int // The passengers in the car, by the floor they are going to.
+	boarded     int                   // The passengers in the car who have not pressed a cab button.
+	load        int                   // In kg, besides the passengers.
+}
+
+func New(config Config) *Elevator {
+	return &Elevator{
+		config:     config,
+		position:   config.StartFloor,
+		lastUpdate: time.Now(),
+		outputs:    make(map[int]bool),
+		buttons:    make(map[int]time.Time),
+		powered:    true,
+	}
+}
+
+// ------------------------ IODevice ------------------------------
+
+func (elev *Elevator) Init() error {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.update()
+	elev.outputs = make(map[int]bool)
+	elev.motorSpeed = 0
+	elev.reset = false
+	return nil
+}
+
+func (elev *Elevator) SetBit(channel int) {
+	elev.writeBit(channel, true)
+}
+
+func (elev *Elevator) ClearBit(channel int) {
+	elev.writeBit(channel, false)
+}
+
+func (elev *Elevator) ReadBit(channel int) bool {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.update()
+	switch channel {
+	case hardware.STOP:
+		return elev.stop
+	case hardware.OBSTRUCTION:
+		return elev.obstruction
+	case hardware.FIRE_RECALL:
+		return elev.recall
+	}
+	for floor, sensor := range floorSensors {
+		if channel == sensor {
+			return elev.floor() == floor
+		}
+	}
+	if release, ok := elev.buttons[channel]; ok {
+		return time.Now().Before(release)
+	}
+	return elev.outputs[channel]
+}
+
+func (elev *Elevator) WriteAnalog(channel, value int) {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.update()
+	if channel == hardware.MOTOR && elev.powered && !elev.reset {
+		elev.motorSpeed = value
+	}
+}
+
+func (elev *Elevator) ReadAnalog(channel int) int {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	switch channel {
+	case hardware.MOTOR:
+		return elev.motorSpeed
+	case hardware.LOAD_SENSOR:
+		passengers := elev.boarded
+		for _, riding := range elev.riding {
+			passengers += riding
+		}
+		return elev.load + passengers*elev.config.PassengerWeight
+	}
+	return 0
+}
+
+// ------------------------ Simulator controls ------------------------------
+
+// Presses a button, which reads as pressed for ButtonDepressedTime. The floor of the door buttons does not matter.
+func (elev *Elevator) Press(buttonType, floor int) {
+	var channel int
+	switch buttonType {
+	case typedef.BUTTON_DOOR_OPEN:
+		channel = hardware.BUTTON_DOOR_OPEN
+	case typedef.BUTTON_DOOR_CLOSE:
+		channel = hardware.BUTTON_DOOR_CLOSE
+	default:
+		channel = buttonChannelMatrix[floor][buttonType]
+	}
+	if channel == -1 {
+		log.Printf("SIMELEV:\t There is no button of type %d at floor %d.\n", buttonType, floor)
+		return
+	}
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.buttons[channel] = time.Now().Add(elev.config.ButtonDepressedTime)
+	switch buttonType {
+	case typedef.BUTTON_CALL_UP, typedef.BUTTON_CALL_DOWN:
+		elev.waiting[floor]++
+	case typedef.BUTTON_COMMAND:
+		if elev.boarded > 0 {
+			elev.boarded--
+			elev.riding[floor]++
+		}
+	}
+}
+
+func (elev *Elevator) SetStop(value bool) {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.stop = value
+}
+
+func (elev *Elevator) SetObstruction(value bool) {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.obstruction = value
+}
+
+// Turns the fire recall key switch.
+func (elev *Elevator) SetRecallSwitch(value bool) {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.recall = value
+}
+
+// Puts a load in the car besides the passengers, in kg, like a pallet of goods.
+func (elev *Elevator) SetLoad(kg int) {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.load = kg
+}
+
+// Cuts the power, the car stops where it is and ignores the motor from now on.
+func (elev *Elevator) PowerOff() {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.update()
+	elev.powered = false
+	elev.motorSpeed = 0
+}
+
+// Jams the car, it stays where it is while the motor still reads as running.
+func (elev *Elevator) JamMotor() {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.update()
+	elev.jammed = true
+}
+
+// Flips the lamp of a button behind the back of the elevator, like a lamp driver which glitches.
+func (elev *Elevator) FlipLamp(buttonType, floor int) {
+	channel := lightChannelMatrix[floor][buttonType]
+	if channel == -1 {
+		return
+	}
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.outputs[channel] = !elev.outputs[channel]
+}
+
+// Resets the IO card: the outputs are cleared, and ignored until the card is initialized again.
+func (elev *Elevator) ResetIO() {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.update()
+	elev.outputs = make(map[int]bool)
+	elev.motorSpeed = 0
+	elev.reset = true
+}
+
+// Returns the floor the car is at, or -1 if it is between floors.
+func (elev *Elevator) Floor() int {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.update()
+	return elev.floor()
+}
+
+func (elev *Elevator) Position() float64 {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.update()
+	return elev.position
+}
+
+// Returns the value of an output, for example hardware.LIGHT_DOOR_OPEN.
+func (elev *Elevator) Output(channel int) bool {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	return elev.outputs[channel]
+}
+
+func (elev *Elevator) DoorOpen() bool {
+	return elev.Output(hardware.LIGHT_DOOR_OPEN)
+}
+
+// Returns whether the lamp of a button is on. There is no lamp for the buttons which do not exist.
+func (elev *Elevator) ButtonLamp(buttonType, floor int) bool {
+	channel := lightChannelMatrix[floor][buttonType]
+	return channel != -1 && elev.Output(channel)
+}
+
+// Returns the floor the floor indicator shows.
+func (elev *Elevator) FloorIndicator() int {
+	floor := 0
+	if elev.Output(hardware.LIGHT_FLOOR_IND1) {
+		floor += 2
+	}
+	if elev.Output(hardware.LIGHT_FLOOR_IND2) {
+		floor++
+	}
+	return floor
+}
+
+// ------------------------ Simulation ------------------------------
+
+func (elev *Elevator) writeBit(channel int, value bool) {
+	elev.mutex.Lock()
+	defer elev.mutex.Unlock()
+	elev.update()
+	if elev.reset {
+		return
+	}
+	if channel == hardware.LIGHT_DOOR_OPEN && value && !elev.outputs[channel] {
+		elev.openDoor()
+	}
+	if channel != -1 {
+		elev.outputs[channel] = value
+	}
+}
+
+// The passengers get off and on when the door opens. Must be called with the mutex held.
+func (elev *Elevator) openDoor() {
+	floor := elev.floor()
+	if floor == -1 {
+		return
+	}
+	elev.riding[floor] = 0
+	elev.boarded = elev.waiting[floor]
+	elev.waiting[floor] = 0
+}
+
+/*
+	Moves the car for the time since the last update. Must be called with the
+	mutex held. The car is stopped at the top and bottom floors, where the real
+	elevator would hit the end switches.
+*/
+func (elev *Elevator) update() {
+	now := time.Now()
+	elapsed := now.Sub(elev.lastUpdate)
+	elev.lastUpdate = now
+	if elev.motorSpeed == 0 || !elev.powered || elev.jammed {
+		return
+	}
+	distance := float64(elapsed) / float64(elev.config.TravelTimeBetweenFloors) * float64(elev.motorSpeed) / nominalMotorSpeed
+	if elev.outputs[hardware.MOTORDIR] {
+		elev.position -= distance
+	} else {
+		elev.position += distance
+	}
+	if elev.position < 0 {
+		if debug {
+			log.Println("SIMELEV:\t The car hit the bottom.")
+		}
+		elev.position = 0
+	} else if top := float64(typedef.N_FLOORS - 1); elev.position > top {
+		if debug {
+			log.Println("SIMELEV:\t The car hit the top.")
+		}
+		elev.position = top
+	}
+}
+
+// Returns the floor whose sensor is active, or -1. Must be called with the mutex held.
+func (elev *Elevator) floor() int {
+	halfSensor := float64(elev.config.TravelTimePassingFloor) / float64(elev.config.TravelTimeBetweenFloors) / 2
+	for floor := 0; floor < typedef.N_FLOORS; floor++ {
+		if elev.position > float64(floor)-halfSensor && elev.position < float64(floor)+halfSensor {
+			return floor
+		}
+	}
+	return -1
+}
@@ -0,0 +1,162 @@
+package traffic
+
+/*
+	This module finds the traffic pattern of the building, which the group
+	module dispatches by. The patterns are the modes in typedef:
+		- up-peak, when most hall calls are up calls at the lobby, like in the
+		  morning when everyone arrives.
+		- down-peak, when most hall calls are down calls above the lobby, like
+		  in the evening when everyone leaves.
+		- inter-floor, the rest of the time.
+	The mode is detected from the hall calls of the last window, or set for a
+	period of the day by a schedule, which wins over the detected mode.
+	In a peak the idle cars park at the floors of the mode. They wait the idle
+	time of the parking policy first, or IdleTime when the policy parks no
+	cars, so the peaks park the cars without a parking policy too.
+*/
+
+import (
+	"fmt"
+	"parking"
+	"strings"
+	"time"
+	"typedef"
+)
+
+type Config struct {
+	Lobby     int
+	Window    time.Duration // How far back the hall calls are counted. 0 does not detect the mode.
+	MinCalls  int           // Fewer hall calls than this in the window is inter-floor traffic.
+	PeakShare float64       // The share of the hall calls which makes a peak.
+	Schedules []Schedule    // The modes set for periods of the day, the first which matches is used.
+	IdleTime  time.Duration // How long a car waits without orders before it parks in a peak, when the parking policy has no idle time. 0 does not park.
+}
+
+// A mode set for a period of the day.
+type Schedule struct {
+	parking.Period
+	Mode int
+}
+
+type call struct {
+	at         time.Time
+	floor      int
+	buttonType int
+}
+
+// Keeps the hall calls of the window, and finds the mode from them.
+type Detector struct {
+	config Config
+	calls  []call
+}
+
+func NewDetector(config Config) *Detector {
+	return &Detector{config: config}
+}
+
+// Counts a new hall call.
+func (d *Detector) Call(now time.Time, floor, buttonType int) {
+	if d.config.Window > 0 {
+		d.calls = append(d.calls, call{at: now, floor: floor, buttonType: buttonType})
+	}
+}
+
+// The mode at the time, from the schedules or the hall calls of the window.
+func (d *Detector) Mode(now time.Time) int {
+	for _, schedule := range d.config.Schedules {
+		if schedule.Contains(now) {
+			return schedule.Mode
+		}
+	}
+	for len(d.calls) > 0 && now.Sub(d.calls[0].at) > d.config.Window {
+		d.calls = d.calls[1:]
+	}
+	if len(d.calls) == 0 || len(d.calls) < d.config.MinCalls {
+		return typedef.TrafficInterFloor
+	}
+	upAtLobby, downAbove := 0, 0
+	for _, c := range d.calls {
+		if c.buttonType == typedef.BUTTON_CALL_UP && c.floor == d.config.Lobby {
+			upAtLobby++
+		} else if c.buttonType == typedef.BUTTON_CALL_DOWN && c.floor > d.config.Lobby {
+			downAbove++
+		}
+	}
+	if float64(upAtLobby) >= d.config.PeakShare*float64(len(d.calls)) {
+		return typedef.TrafficUpPeak
+	} else if float64(downAbove) >= d.config.PeakShare*float64(len(d.calls)) {
+		return typedef.TrafficDownPeak
+	}
+	return typedef.TrafficInterFloor
+}
+
+/*
+	The park floors of the mode for the cars: all at the lobby in up-peak, and
+	from the top floor down in down-peak. Inter-floor has none of its own.
+*/
+func (config Config) ParkFloors(mode, cars int) []int {
+	upper := typedef.N_FLOORS - 1 - config.Lobby // The floors above the lobby.
+	if upper < 1 {
+		upper = 1
+	}
+	var floors []int
+	for i := 0; i < cars; i++ {
+		switch mode {
+		case typedef.TrafficUpPeak:
+			floors = append(floors, config.Lobby)
+		case typedef.TrafficDownPeak:
+			floors = append(floors, typedef.N_FLOORS-1-i%upper)
+		}
+	}
+	return floors
+}
+
+// ------------------------ Written in the config ------------------------------
+
+var modeNames = map[int]string{
+	typedef.TrafficInterFloor: "inter-floor",
+	typedef.TrafficUpPeak:     "up-peak",
+	typedef.TrafficDownPeak:   "down-peak",
+}
+
+func ModeName(mode int) string {
+	if name, ok := modeNames[mode]; ok {
+		return name
+	}
+	return fmt.Sprintf("mode %d", mode)
+}
+
+// Returns the mode with the name, "inter-floor", "up-peak" or "down-peak".
+func ModeByName(name string) (int, error) {
+	for mode, modeName := range modeNames {
+		if modeName == name {
+			return mode, nil
+		}
+	}
+	return typedef.TrafficInterFloor, fmt.Errorf("TRAFFIC:\t There is no mode %q, use inter-floor, up-peak or down-peak.", name)
+}
+
+// Reads the schedules written like "07:30-09:30=up-peak; 16:00-18:00=down-peak".
+func ParseSchedules(s string) ([]Schedule, error) {
+	var schedules []Schedule
+	for _, field := range strings.Split(s, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		period, name, found := strings.Cut(field, "=")
+		if !found {
+			return nil, fmt.Errorf("TRAFFIC:\t The schedule %q is not written like 07:30-09:30=up-peak.", field)
+		}
+		var schedule Schedule
+		var err error
+		if schedule.Period, err = parking.ParsePeriod(period); err != nil {
+			return nil, err
+		}
+		if schedule.Mode, err = ModeByName(strings.TrimSpace(name)); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
@@ -0,0 +1,122 @@
+package traffic
+
+import (
+	"parking"
+	"reflect"
+	"testing"
+	"time"
+	"typedef"
+)
+
+func TestDetectorMode(t *testing.T) {
+	up, down := typedef.BUTTON_CALL_UP, typedef.BUTTON_CALL_DOWN
+	config := Config{Lobby: 0, Window: time.Minute, MinCalls: 4, PeakShare: 0.6}
+	type hallCall struct {
+		at         time.Duration
+		floor      int
+		buttonType int
+	}
+	tests := []struct {
+		name  string
+		calls []hallCall
+		at    time.Duration
+		want  int
+	}{
+		{"no calls", nil, time.Minute, typedef.TrafficInterFloor},
+		{"too few calls", []hallCall{{0, 0, up}, {time.Second, 0, up}, {2 * time.Second, 0, up}}, 3 * time.Second, typedef.TrafficInterFloor},
+		{"up-peak", []hallCall{{0, 0, up}, {time.Second, 0, up}, {2 * time.Second, 0, up}, {3 * time.Second, 2, down}}, 4 * time.Second, typedef.TrafficUpPeak},
+		{"down-peak", []hallCall{{0, 3, down}, {time.Second, 2, down}, {2 * time.Second, 1, down}, {3 * time.Second, 0, up}}, 4 * time.Second, typedef.TrafficDownPeak},
+		{"mixed", []hallCall{{0, 0, up}, {time.Second, 3, down}, {2 * time.Second, 1, up}, {3 * time.Second, 2, down}}, 4 * time.Second, typedef.TrafficInterFloor},
+		{"up at other floors", []hallCall{{0, 1, up}, {time.Second, 2, up}, {2 * time.Second, 1, up}, {3 * time.Second, 2, up}}, 4 * time.Second, typedef.TrafficInterFloor},
+		{"at the peak share", []hallCall{{0, 0, up}, {time.Second, 0, up}, {2 * time.Second, 0, up}, {3 * time.Second, 1, up}, {4 * time.Second, 2, up}}, 5 * time.Second, typedef.TrafficUpPeak},
+		{"old calls leave the window", []hallCall{{0, 0, up}, {time.Second, 0, up}, {2 * time.Second, 0, up}, {70 * time.Second, 0, up}}, 70 * time.Second, typedef.TrafficInterFloor},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			d := NewDetector(config)
+			for _, c := range test.calls {
+				d.Call(start.Add(c.at), c.floor, c.buttonType)
+			}
+			if mode := d.Mode(start.Add(test.at)); mode != test.want {
+				t.Errorf("mode %s, want %s", ModeName(mode), ModeName(test.want))
+			}
+		})
+	}
+}
+
+func TestDetectorWithoutWindow(t *testing.T) {
+	d := NewDetector(Config{MinCalls: 1, PeakShare: 0.5})
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		d.Call(now, 0, typedef.BUTTON_CALL_UP)
+	}
+	if mode := d.Mode(now); mode != typedef.TrafficInterFloor {
+		t.Errorf("mode %s without a window, want inter-floor", ModeName(mode))
+	}
+}
+
+func TestDetectorSchedules(t *testing.T) {
+	schedules, err := ParseSchedules("07:30-09:30=up-peak; 16:00-18:00=down-peak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDetector(Config{Window: time.Minute, MinCalls: 1, PeakShare: 0.5, Schedules: schedules})
+	day := time.Date(2016, time.February, 13, 0, 0, 0, 0, time.Local)
+	d.Call(day.Add(8*time.Hour), 3, typedef.BUTTON_CALL_DOWN)
+	tests := []struct {
+		clock time.Duration
+		want  int
+	}{
+		{8 * time.Hour, typedef.TrafficUpPeak}, // The schedule wins over the calls.
+		{17 * time.Hour, typedef.TrafficDownPeak},
+		{12 * time.Hour, typedef.TrafficInterFloor},
+	}
+	for _, test := range tests {
+		if mode := d.Mode(day.Add(test.clock)); mode != test.want {
+			t.Errorf("mode %s at %v, want %s", ModeName(mode), test.clock, ModeName(test.want))
+		}
+	}
+}
+
+func TestParseSchedules(t *testing.T) {
+	schedules, err := ParseSchedules(" 07:30-09:30 = up-peak ;22:00-02:00=inter-floor; ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Schedule{
+		{parking.Period{From: 7*time.Hour + 30*time.Minute, To: 9*time.Hour + 30*time.Minute}, typedef.TrafficUpPeak},
+		{parking.Period{From: 22 * time.Hour, To: 2 * time.Hour}, typedef.TrafficInterFloor},
+	}
+	if !reflect.DeepEqual(schedules, want) {
+		t.Errorf("schedules %+v, want %+v", schedules, want)
+	}
+	for _, s := range []string{"07:30-09:30", "07:30-09:30=rush-hour", "7-9=up-peak"} {
+		if _, err := ParseSchedules(s); err == nil {
+			t.Errorf("ParseSchedules(%q) did not fail", s)
+		}
+	}
+}
+
+func TestParkFloors(t *testing.T) {
+	config := Config{Lobby: 0}
+	tests := []struct {
+		name string
+		mode int
+		cars int
+		want []int
+	}{
+		{"inter-floor", typedef.TrafficInterFloor, 3, nil},
+		{"up-peak", typedef.TrafficUpPeak, 3, []int{0, 0, 0}},
+		{"down-peak", typedef.TrafficDownPeak, 2, []int{typedef.N_FLOORS - 1, typedef.N_FLOORS - 2}},
+		{"down-peak with more cars than floors", typedef.TrafficDownPeak, typedef.N_FLOORS, []int{3, 2, 1, 3}},
+		{"no cars", typedef.TrafficUpPeak, 0, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if floors := config.ParkFloors(test.mode, test.cars); !reflect.DeepEqual(floors, test.want) {
+				t.Errorf("ParkFloors(%s, %d) = %v, want %v", ModeName(test.mode), test.cars, floors, test.want)
+			}
+		})
+	}
+}
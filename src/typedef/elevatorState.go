@@ -0,0 +1,208 @@
+package typedef
+
+import "fmt"
+
+// Keep all relevant variables in a struct, split for networking with external orders in extended state?
+type ElevatorState struct {
+	Lastfloor      int
+	Direction      int
+	Moving         bool
+	OpenDoor       bool
+	OutOfService   bool // The car can not move, and serves no orders.
+	Service        int  // The service mode, ServiceNormal in the group.
+	InternalOrders [N_FLOORS]bool
+	ExternalOrders [N_FLOORS][N_BUTTONS - 1]bool
+	Destinations   [N_FLOORS]bool // Where the passengers the car picks up are going, cab orders when they board.
+	Load           int            // In percent of the capacity of the car, 0 if it has no load sensor.
+	Full           bool           // The load is above the full-load threshold of the car.
+}
+
+func (state *ElevatorState) SetDirection(dir int) {
+	state.Direction = dir
+}
+
+func (state *ElevatorState) SetMoving(moving bool) {
+	state.Moving = moving
+}
+
+func (state *ElevatorState) SetOpenDoor(open bool) {
+	state.OpenDoor = open
+}
+
+func (state *ElevatorState) SetOutOfService(outOfService bool) {
+	state.OutOfService = outOfService
+}
+
+// Whether the car can be given hall calls: it is in service, and in the group.
+func (state *ElevatorState) TakesHallCalls() bool {
+	return !state.OutOfService && state.Service == ServiceNormal
+}
+
+// Whether a full car passes the hall call by: it is going the way of the call, and nobody could get on.
+func (state *ElevatorState) Passes(buttonType int) bool {
+	return state.Full && ((state.Direction == DIR_UP && buttonType == BUTTON_CALL_UP) || (state.Direction == DIR_DOWN && buttonType == BUTTON_CALL_DOWN))
+}
+
+func (state *ElevatorState) SetLastFloor(floor int) {
+	state.Lastfloor = floor
+}
+
+func (state *ElevatorState) HaveOrders() bool {
+	return state.HaveOrderBelow() || state.HaveOrderAbove() || state.HaveOrdersAtCurrentFloor()
+}
+
+func (state *ElevatorState) HaveOrderAbove() bool {
+	for floor := N_FLOORS - 1; floor > state.Lastfloor; floor-- {
+		if state.InternalOrders[floor] {
+			return true
+		}
+
+		for _, order := range state.ExternalOrders[floor] {
+			if order {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (state *ElevatorState) HaveOrderBelow() bool {
+	for floor := 0; floor < state.Lastfloor; floor++ {
+		if state.InternalOrders[floor] {
+			return true
+		}
+
+		for _, order := range state.ExternalOrders[floor] {
+			if order {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (state *ElevatorState) HaveOrdersAtCurrentFloor() bool {
+	if state.InternalOrders[state.Lastfloor] {
+		return true
+	}
+	for _, order := range state.ExternalOrders[state.Lastfloor] {
+		if order {
+			return true
+		}
+	}
+	return false
+}
+
+func (state *ElevatorState) PrintOrders() {
+	for n, orders := range state.ExternalOrders {
+		fmt.Printf("\t\t\t%t\t%t\t%t\n", orders[0], orders[1], state.InternalOrders[n])
+	}
+}
+
+func (state *ElevatorState) PrintState() {
+	fmt.Printf("\tElevatorState:\n\t\ttLastfloor: %d\tDirection: %d\t\n\t\tMoving: %t\tOpenDoor: %t\n", state.Lastfloor, state.Direction, state.Moving, state.OpenDoor)
+	if state.OutOfService {
+		fmt.Printf("\t\tOut of service\n")
+	}
+	if state.Service != ServiceNormal {
+		fmt.Printf("\t\tIn %s\n", ServiceName(state.Service))
+	}
+	if state.Full {
+		fmt.Printf("\t\tFull, %d%% load\n", state.Load)
+	} else if state.Load > 0 {
+		fmt.Printf("\t\t%d%% load\n", state.Load)
+	}
+	fmt.Printf("\tOrders: \n")
+	state.PrintOrders()
+}
+
+/*
+	ExternalOrders[floor][BUTTON_CALL_UP] is an up call and [BUTTON_CALL_DOWN] a
+	down call. A full car does not stop for the hall calls it passes.
+*/
+func (state *ElevatorState) ShouldStop() bool {
+	if state.InternalOrders[state.Lastfloor] {
+		return true
+	}
+	up := state.ExternalOrders[state.Lastfloor][BUTTON_CALL_UP] && !state.Passes(BUTTON_CALL_UP)
+	down := state.ExternalOrders[state.Lastfloor][BUTTON_CALL_DOWN] && !state.Passes(BUTTON_CALL_DOWN)
+	if state.Direction == DIR_DOWN {
+		if down {
+			return true
+		}
+	}
+	if state.Direction == DIR_UP {
+		if up {
+			return true
+		}
+	}
+	if !state.HaveOrderAbove() && down {
+		return true
+	}
+	if !state.HaveOrderBelow() && up {
+		return true
+	}
+	if !state.HaveOrderAbove() && !state.HaveOrderBelow() {
+		return true
+	}
+	return false
+}
+
+/*
+	Returns the floor the car will stop at next, going in its direction from the
+	last floor, or the end floor if there is no order on the way. Returns -1 if
+	it has no direction.
+*/
+func (state *ElevatorState) NextStop() int {
+	if state.Direction == DIR_STOP {
+		return -1
+	}
+	ahead := *state
+	for floor := state.Lastfloor + state.Direction; floor >= 0 && floor < N_FLOORS; floor += state.Direction {
+		ahead.Lastfloor = floor
+		if ahead.ShouldStop() {
+			return floor
+		}
+	}
+	if state.Direction == DIR_UP {
+		return N_FLOORS - 1
+	}
+	return 0
+}
+
+func (state *ElevatorState) NextDirection() int {
+	if state.Direction == DIR_UP && state.HaveOrderAbove() {
+		return DIR_UP
+	} else if state.Direction == DIR_DOWN && state.HaveOrderBelow() {
+		return DIR_DOWN
+	} else if state.HaveOrderBelow() {
+		return DIR_DOWN
+	} else if state.HaveOrderAbove() {
+		return DIR_UP
+	}
+	return DIR_STOP // Returns 0 if there are no orders.
+}
+
+var serviceNames = map[int]string{
+	ServiceNormal:      "normal",
+	ServiceMaintenance: "maintenance",
+	ServiceInspection:  "inspection",
+	ServiceIndependent: "independent",
+}
+
+func ServiceName(mode int) string {
+	if name, ok := serviceNames[mode]; ok {
+		return name
+	}
+	return fmt.Sprintf("service mode %d", mode)
+}
+
+// Returns the service mode with the name, "normal", "maintenance", "inspection" or "independent".
+func ServiceByName(name string) (int, error) {
+	for mode, modeName := range serviceNames {
+		if modeName == name {
+			return mode, nil
+		}
+	}
+	return ServiceNormal, fmt.Errorf("There is no service mode %q, use normal, maintenance, inspection or independent.", name)
+}
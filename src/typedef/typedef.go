@@ -22,6 +22,9 @@ const (
 	BUTTON_STOP
 	OBSTRUCTION_SENS
 	DOOR_LAMP
+	BUTTON_DOOR_OPEN
+	BUTTON_DOOR_CLOSE
+	RECALL_SWITCH
 )
 
 // Events
@@ -36,6 +39,27 @@ const(
 	EventOrderDone
 	EventAcknowledgeOrderDone
 	EventReassignOrder
+	EventLeaving
+	EventRecall               // A command, Order.Value turns the fire recall on or off.
+	EventService              // A command, the elevator AssignedTo goes into the service mode State.Service.
+	EventDestinationCall      // A command, a passenger makes the Call.
+	EventDestinationAssigned  // The master's answer, the elevator AssignedTo takes the passenger of the Call.
+	EventDestinationConfirmed // The answer of the elevator given the Call, which the panel waits for.
+)
+
+// Traffic modes, see the traffic module.
+const (
+	TrafficInterFloor = iota
+	TrafficUpPeak
+	TrafficDownPeak
+)
+
+// Service modes of a car, see the elevator module.
+const (
+	ServiceNormal      = iota
+	ServiceMaintenance // Out of the group, serves no orders.
+	ServiceInspection  // Out of the group, serves cab orders only.
+	ServiceIndependent // Out of the group, reserved: serves one cab order at a time, and waits with the door open.
 )
 
 // Order status
@@ -45,4 +69,42 @@ const (
 	Executing
 )
 
+// -------------------------- Structs ----------------------------
+
+// An order at a floor, passed between the modules.
+type Order struct {
+	Floor      int
+	ButtonType int
+	Value      bool // True to set the order, false to clear it.
+}
+
+/*
+	A passenger at a destination dispatch panel, going from the Origin floor to
+	the Destination floor. The panel counts up the Number for every call, so a
+	call it sends again is known by the Panel and the Number.
+*/
+type DestinationCall struct {
+	Origin      int
+	Destination int
+	Panel       string // The ip of the panel, set by the master.
+	Number      int
+}
+
+// A fire recall command. Of two commands the one with the highest Number is the latest.
+type Recall struct {
+	On     bool
+	Number int
+}
 
+// The struct passed on the network between the elevators.
+type ElevatorMessage struct {
+	Event      int                             // One of the events above.
+	SenderIp   string                          // Ip of the sending elevator.
+	Order      Order                           // The order the event is about, if any.
+	AssignedTo string                          // Ip of the elevator responsible for the order.
+	State      ElevatorState                   // The state of the sender.
+	HallOrders [N_FLOORS][N_BUTTONS - 1]string // Which elevator is serving each hall call, "" if none.
+	Traffic    int                             // The traffic mode the master dispatches by.
+	Recall     Recall                          // The latest fire recall command the sender knows of.
+	Call       DestinationCall                 // The call of an EventDestinationCall or EventDestinationAssigned.
+}
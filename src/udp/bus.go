@@ -0,0 +1,153 @@
+package udp
+
+/*
+	The Bus is an in-memory network replacing the UDP sockets, so several
+	elevators can run in one process, for example in the test harness.
+	Every elevator on the bus gets a made up IP address. Messages sent to
+	"broadcast" are received by every elevator on the bus (also the sender,
+	like a real broadcast), and other messages by the elevator with the IP
+	address in RAddress. Like UDP, messages to an elevator which is not
+	reading are dropped. An elevator is detached when its context is done.
+*/
+
+import (
+	"context"
+	"fmt"
+	"lifecycle"
+	"log"
+	"net"
+	"sync"
+)
+
+// How many received messages are kept for an elevator before they are dropped.
+const busQueueSize = 64
+
+// The port the messages on the bus appear to be sent from.
+const busPort = 22301
+
+type Bus struct {
+	mutex sync.Mutex
+	nodes map[string]chan UDPMessage
+}
+
+func NewBus() *Bus {
+	return &Bus{nodes: make(map[string]chan UDPMessage)}
+}
+
+// Returns a Transport attaching an elevator to the bus with the given IP address.
+func (bus *Bus) Transport(ip string) Transport {
+	return func(ctx context.Context, sendChannel <-chan UDPMessage, receiveChannel chan<- UDPMessage) (string, *lifecycle.Handle, error) {
+		return bus.Start(ctx, ip, sendChannel, receiveChannel)
+	}
+}
+
+// Attaches an elevator to the bus for good, like Init does for the sockets.
+func (bus *Bus) Init(ip string, sendChannel <-chan UDPMessage, receiveChannel chan<- UDPMessage) (localIP string, err error) {
+	localIP, _, err = bus.Start(context.Background(), ip, sendChannel, receiveChannel)
+	return localIP, err
+}
+
+/*
+	Attaches an elevator to the bus until the context is done, like Start does
+	for the sockets. Returns an error if the IP address is in use.
+*/
+func (bus *Bus) Start(ctx context.Context, ip string, sendChannel <-chan UDPMessage, receiveChannel chan<- UDPMessage) (localIP string, handle *lifecycle.Handle, err error) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	if _, ok := bus.nodes[ip]; ok {
+		return "", nil, fmt.Errorf("UDP:\t The address %s is already on the bus.", ip)
+	}
+	queue := make(chan UDPMessage, busQueueSize)
+	bus.nodes[ip] = queue
+	handle, ctx = lifecycle.New(ctx)
+	handle.Cleanup(func() { bus.detach(ip, queue) })
+	handle.Go(func() { busReceiver(ctx, queue, receiveChannel) })
+	handle.Go(func() { bus.transmitter(ctx, ip, sendChannel) })
+	return ip, handle, nil
+}
+
+/*
+	Removes an elevator from the bus, as if its cable was pulled. It no longer
+	receives anything, and what it sends is lost.
+*/
+func (bus *Bus) Detach(ip string) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	if queue, ok := bus.nodes[ip]; ok {
+		delete(bus.nodes, ip)
+		close(queue)
+	}
+}
+
+// Detaches the elevator with the queue, if it has not been detached already.
+func (bus *Bus) detach(ip string, queue chan UDPMessage) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	if bus.nodes[ip] == queue {
+		delete(bus.nodes, ip)
+		close(queue)
+	}
+}
+
+// Sends the messages from one elevator to the queues of the receivers, and what is left when the context is done.
+func (bus *Bus) transmitter(ctx context.Context, ip string, sendChannel <-chan UDPMessage) {
+	returnAddress := net.JoinHostPort(ip, fmt.Sprint(busPort))
+	for {
+		var msg UDPMessage
+		select {
+		case msg = <-sendChannel:
+		case <-ctx.Done():
+			select {
+			case msg = <-sendChannel:
+			default:
+				return
+			}
+		}
+		bus.mutex.Lock()
+		if _, attached := bus.nodes[ip]; attached {
+			data := append([]byte(nil), msg.Data...)
+			received := UDPMessage{RAddress: returnAddress, Data: data, Length: len(data)}
+			if msg.RAddress == "broadcast" {
+				for _, queue := range bus.nodes {
+					deliver(queue, received)
+				}
+			} else if host, _, err := net.SplitHostPort(msg.RAddress); err != nil {
+				log.Println("UDP:\t Bus could not resolve address:", msg.RAddress)
+			} else if queue, ok := bus.nodes[host]; ok {
+				deliver(queue, received)
+			}
+		}
+		bus.mutex.Unlock()
+	}
+}
+
+func deliver(queue chan<- UDPMessage, msg UDPMessage) {
+	select {
+	case queue <- msg:
+	default:
+		if debug {
+			log.Println("UDP:\t Bus dropped a message to a full queue.")
+		}
+	}
+}
+
+// Passes the messages in the queue on, until the elevator is detached or the context is done.
+func busReceiver(ctx context.Context, queue <-chan UDPMessage, receiveChannel chan<- UDPMessage) {
+	for {
+		var msg UDPMessage
+		var attached bool
+		select {
+		case msg, attached = <-queue:
+			if !attached {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case receiveChannel <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package udp
+
+/*
+	The UDP module does not stop the elevator when something goes wrong. The
+	errors are sent as events on the Errors channel of the Config, as one of the
+	types below, so the receiver can tell them apart with errors.As. Without a
+	channel they are logged, and when the channel is full they are dropped.
+	A socket which fails is closed and opened again, and a server goroutine
+	which panics is started again, so the elevator keeps running.
+*/
+
+import (
+	"context"
+	"fmt"
+	"lifecycle"
+	"time"
+)
+
+// How long to wait before a server or socket is started again.
+const restartDelay = 100 * time.Millisecond
+
+// Reading fails this many times in a row before the socket is opened again.
+const maxReadErrors = 10
+
+// A message to an address which could not be resolved. The message is dropped.
+type AddressError struct {
+	Address string
+	Err     error
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("UDP:\t Could not resolve the address %q: %v", e.Address, e.Err)
+}
+
+func (e *AddressError) Unwrap() error { return e.Err }
+
+/*
+	Opening, reading from or writing to a socket failed. When Reopened is true the socket
+	was closed, or failed too many times, and has been opened again.
+*/
+type SocketError struct {
+	Socket   string // "local" or "broadcast".
+	Op       string // "read", "write" or "open".
+	Err      error
+	Reopened bool
+}
+
+func (e *SocketError) Error() string {
+	s := fmt.Sprintf("UDP:\t Could not %s the %s socket: %v", e.Op, e.Socket, e.Err)
+	if e.Reopened {
+		s += ", it has been opened again"
+	}
+	return s
+}
+
+func (e *SocketError) Unwrap() error { return e.Err }
+
+// A server goroutine panicked, and has been started again.
+type ServerError struct {
+	Server string
+	Err    error
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("UDP:\t The %s failed and has been started again: %v", e.Server, e.Err)
+}
+
+func (e *ServerError) Unwrap() error { return e.Err }
+
+/*
+	Runs the server until it returns. If it panics the panic is reported, and it
+	is started again after restartDelay unless the context is done.
+*/
+func serve(ctx context.Context, server string, errorChannel chan<- error, run func()) {
+	for {
+		err := recoverPanic(run)
+		if err == nil {
+			return
+		}
+		lifecycle.Report(errorChannel, &ServerError{Server: server, Err: err})
+		select {
+		case <-time.After(restartDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func recoverPanic(run func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	run()
+	return nil
+}
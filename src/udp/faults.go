@@ -0,0 +1,194 @@
+package udp
+
+/*
+	The FaultInjector sits between the send and receive channels and a
+	Transport (the sockets of Init, or a Bus), and makes the network worse on
+	purpose, to test that the elevators survive it. It can lose, delay, reorder
+	and duplicate messages, and cut the connection to a peer.
+	The faults are given as FaultRules for each peer IP, or "ip:port" for
+	elevators sharing an IP with port offsets, and can be changed
+	while running. A rule applies to the messages received from the peer and
+	the messages sent directly to it. Broadcasts are only affected when they
+	are received, so every receiver decides for itself if it gets them.
+	The random numbers come from the seed given to NewFaultInjector, so a run
+	with the same messages makes the same decisions.
+*/
+
+import (
+	"context"
+	"lifecycle"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// The faults for the messages to and from a peer.
+type FaultRule struct {
+	Loss        float64       // The probability that a message is lost, 0 to 1.
+	Latency     time.Duration // Added to every message.
+	Jitter      time.Duration // Up to this is added at random to every message, which reorders them.
+	Duplication float64       // The probability that a message arrives twice, 0 to 1.
+	Partitioned bool          // Every message is lost.
+}
+
+type FaultInjector struct {
+	mutex       sync.Mutex
+	random      *rand.Rand
+	defaultRule FaultRule
+	rules       map[string]FaultRule
+}
+
+func NewFaultInjector(seed int64) *FaultInjector {
+	return &FaultInjector{
+		random: rand.New(rand.NewSource(seed)),
+		rules:  make(map[string]FaultRule),
+	}
+}
+
+// Sets the rule for the peer with the given IP or "ip:port". The rule for "" is used for peers without a rule.
+func (injector *FaultInjector) SetRule(peer string, rule FaultRule) {
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+	if peer == "" {
+		injector.defaultRule = rule
+	} else {
+		injector.rules[peer] = rule
+	}
+}
+
+// Removes the rule for a peer, it then gets the rule for "".
+func (injector *FaultInjector) ClearRule(peer string) {
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+	delete(injector.rules, peer)
+}
+
+// Removes all the rules, so the network is as good as it gets.
+func (injector *FaultInjector) ClearRules() {
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+	injector.defaultRule = FaultRule{}
+	injector.rules = make(map[string]FaultRule)
+}
+
+// Returns a Transport which passes the messages through the injector on their way to and from next.
+func (injector *FaultInjector) Transport(next Transport) Transport {
+	return func(ctx context.Context, sendChannel <-chan UDPMessage, receiveChannel chan<- UDPMessage) (string, *lifecycle.Handle, error) {
+		nextSendChannel := make(chan UDPMessage, cap(sendChannel))
+		nextReceiveChannel := make(chan UDPMessage)
+		handle, ctx := lifecycle.New(ctx)
+		localIP, err := StartNext(ctx, handle, next, nextSendChannel, nextReceiveChannel)
+		if err != nil {
+			return "", nil, err
+		}
+		handle.Go(func() { injector.pass(ctx, sendChannel, nextSendChannel, true) })
+		handle.Go(func() { injector.pass(ctx, nextReceiveChannel, receiveChannel, false) })
+		return localIP, handle, nil
+	}
+}
+
+/*
+	Passes the messages from in to out, with the faults of the peer they are to or from, until the
+	context is done. Then the messages left to send are passed on, the received ones are dropped.
+*/
+func (injector *FaultInjector) pass(ctx context.Context, in <-chan UDPMessage, out chan<- UDPMessage, sending bool) {
+	for {
+		var msg UDPMessage
+		select {
+		case msg = <-in:
+		case <-ctx.Done():
+			if !sending {
+				return
+			}
+			select {
+			case msg = <-in:
+			default:
+				return
+			}
+		}
+		if sending && msg.RAddress == "broadcast" {
+			forward(ctx, out, msg, sending)
+			continue
+		}
+		copies, delays := injector.decide(msg.RAddress)
+		if copies == 0 {
+			msg.Release()
+		}
+		for i := 0; i < copies; i++ {
+			delayed := msg
+			if i > 0 {
+				delayed = msg.Clone() // Both copies are released by the receiver.
+			}
+			if delays[i] == 0 {
+				forward(ctx, out, delayed, sending)
+			} else {
+				time.AfterFunc(delays[i], func() {
+					select {
+					case out <- delayed:
+					case <-ctx.Done(): // Lost when the transport stops.
+						delayed.Release()
+					}
+				})
+			}
+		}
+	}
+}
+
+/*
+	Passes a message on. The messages to send are always passed on, as the next transport is
+	running until they are. The received messages are dropped when the context is done, as
+	nothing reads them any more.
+*/
+func forward(ctx context.Context, out chan<- UDPMessage, msg UDPMessage, sending bool) {
+	if sending {
+		out <- msg
+		return
+	}
+	select {
+	case out <- msg:
+	case <-ctx.Done():
+		msg.Release()
+	}
+}
+
+// Decides how many times a message to or from the peer at the address arrives, and how late.
+func (injector *FaultInjector) decide(address string) (copies int, delays [2]time.Duration) {
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+	peer := address
+	rule, ok := injector.rules[address]
+	if !ok {
+		peer = peerIP(address)
+		rule, ok = injector.rules[peer]
+	}
+	if !ok {
+		rule = injector.defaultRule
+	}
+	if rule.Partitioned || injector.random.Float64() < rule.Loss {
+		if debug {
+			log.Println("UDP:\t Fault injector lost a message for", peer)
+		}
+		return 0, delays
+	}
+	copies = 1
+	if injector.random.Float64() < rule.Duplication {
+		copies = 2
+	}
+	for i := 0; i < copies; i++ {
+		delays[i] = rule.Latency
+		if rule.Jitter > 0 {
+			delays[i] += time.Duration(injector.random.Int63n(int64(rule.Jitter)))
+		}
+	}
+	return copies, delays
+}
+
+// Returns the IP part of an "ip:port" address.
+func peerIP(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
@@ -0,0 +1,44 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package udp
+
+import (
+	"net"
+	"syscall"
+)
+
+/*
+	Sets the TTL and the interface of the multicast messages sent on the
+	connection, and makes them loop back to the elevators on this machine.
+	A nil interface lets the system choose.
+*/
+func setMulticastOptions(connection *net.UDPConn, networkInterface *net.Interface, ttl int) error {
+	var interfaceAddress [4]byte
+	if networkInterface != nil {
+		address, err := interfaceIPv4(networkInterface)
+		if err != nil {
+			return err
+		}
+		copy(interfaceAddress[:], net.ParseIP(address).To4())
+	}
+	rawConnection, err := connection.SyscallConn()
+	if err != nil {
+		return err
+	}
+	controlErr := rawConnection.Control(func(fd uintptr) {
+		if err = syscall.SetsockoptByte(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, byte(ttl)); err != nil {
+			return
+		}
+		if err = syscall.SetsockoptByte(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, 1); err != nil {
+			return
+		}
+		if networkInterface != nil {
+			err = syscall.SetsockoptInet4Addr(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, interfaceAddress)
+		}
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package udp
+
+import (
+	"errors"
+	"net"
+)
+
+func setMulticastOptions(connection *net.UDPConn, networkInterface *net.Interface, ttl int) error {
+	return errors.New("UDP:\t Multicast is not supported here, use broadcast.")
+}
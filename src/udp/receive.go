@@ -0,0 +1,139 @@
+package udp
+
+/*
+	The receive path of the sockets is made to run without allocating memory
+	for every packet, so a flood of packets does not keep the garbage
+	collector busy while the elevators are running:
+		- The packets are read into buffers from a pool. The buffer of a
+		  received UDPMessage goes back to the pool when Release is called.
+		  A message which is not released is left to the garbage collector, and
+		  the pool allocates a new buffer.
+		- The return addresses are kept as strings for every peer, instead of
+		  making a new string for every packet.
+		- The readers put the packets in a bounded queue without waiting, and
+		  the queue is emptied into the receive channel. When the queue is full
+		  a packet is dropped by the DropPolicy.
+	Counters tells how it went.
+*/
+
+import (
+	"net/netip"
+	"sync/atomic"
+)
+
+const defaultReceiveQueueSize = 64
+
+// The most return addresses kept as strings by each reader. The cache starts over when it is full.
+const maxCachedAddresses = 256
+
+// Which packet is dropped when the receive queue is full.
+type DropPolicy int
+
+const (
+	DropNewest DropPolicy = iota // The packet that did not fit in the queue.
+	DropOldest                   // The oldest packet in the queue, to make room for the new one.
+)
+
+// Counts what happened to the received packets. Safe to read while running.
+type Counters struct {
+	Received          atomic.Uint64 // Packets read from the sockets.
+	Dropped           atomic.Uint64 // Packets dropped because the receive queue was full.
+	BufferAllocations atomic.Uint64 // Buffers allocated because the pool was empty.
+	ReadErrors        atomic.Uint64
+}
+
+/*
+	Gives the buffer of a received message back to the pool, when the receiver
+	is done with it. The Data of the message must not be used after this, and
+	Release must only be called once for every message received. Messages not
+	from the sockets have no buffer, then Release does nothing.
+*/
+func (msg UDPMessage) Release() {
+	if msg.pool != nil {
+		msg.pool.put(msg.buffer)
+	}
+}
+
+// Returns a copy of the message with its own Data, without a buffer from the pool.
+func (msg UDPMessage) Clone() UDPMessage {
+	data := append([]byte(nil), msg.Data...)
+	return UDPMessage{RAddress: msg.RAddress, Data: data, Length: msg.Length}
+}
+
+// The buffers of received packets. It holds up to the size of the receive queue, as more are not used at once.
+type bufferPool struct {
+	free     chan []byte
+	size     int
+	counters *Counters
+}
+
+func newBufferPool(buffers, size int, counters *Counters) *bufferPool {
+	return &bufferPool{free: make(chan []byte, buffers), size: size, counters: counters}
+}
+
+func (pool *bufferPool) get() []byte {
+	select {
+	case buffer := <-pool.free:
+		return buffer
+	default:
+		pool.counters.BufferAllocations.Add(1)
+		return make([]byte, pool.size)
+	}
+}
+
+func (pool *bufferPool) put(buffer []byte) {
+	select {
+	case pool.free <- buffer[:pool.size]:
+	default:
+	}
+}
+
+// The packets read from the sockets, on their way to the receive channel.
+type receiveQueue struct {
+	queue    chan UDPMessage
+	policy   DropPolicy
+	counters *Counters
+}
+
+func newReceiveQueue(size int, policy DropPolicy, counters *Counters) *receiveQueue {
+	return &receiveQueue{queue: make(chan UDPMessage, size), policy: policy, counters: counters}
+}
+
+// Puts the message in the queue without waiting, and drops a message if it is full.
+func (q *receiveQueue) push(msg UDPMessage) {
+	for {
+		select {
+		case q.queue <- msg:
+			return
+		default:
+		}
+		if q.policy == DropNewest {
+			q.counters.Dropped.Add(1)
+			msg.Release()
+			return
+		}
+		select {
+		case oldest := <-q.queue:
+			q.counters.Dropped.Add(1)
+			oldest.Release()
+		default:
+		}
+	}
+}
+
+// The return addresses as strings, for one reader.
+type addressCache map[netip.AddrPort]string
+
+func (cache addressCache) lookup(address netip.AddrPort) string {
+	if s, ok := cache[address]; ok {
+		return s
+	}
+	if len(cache) >= maxCachedAddresses {
+		for key := range cache {
+			delete(cache, key)
+		}
+	}
+	s := netip.AddrPortFrom(address.Addr().Unmap(), address.Port()).String()
+	cache[address] = s
+	return s
+}
@@ -0,0 +1,134 @@
+package udp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+const benchmarkPort = 24501
+const benchmarkPacketSize = 512
+const benchmarkTimeout = 100 * time.Millisecond
+
+// Fills a queue of three with five packets, numbered by their Length, and checks which are kept.
+func TestReceiveQueueDrops(t *testing.T) {
+	tests := []struct {
+		policy DropPolicy
+		name   string
+		kept   []int
+	}{
+		{DropNewest, "drop newest", []int{0, 1, 2}},
+		{DropOldest, "drop oldest", []int{2, 3, 4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counters := &Counters{}
+			pool := newBufferPool(4, 16, counters)
+			q := newReceiveQueue(3, test.policy, counters)
+			var messages []UDPMessage
+			for i := 0; i < 5; i++ {
+				messages = append(messages, UDPMessage{Length: i, pool: pool, buffer: pool.get()})
+			}
+			for _, msg := range messages {
+				q.push(msg)
+			}
+			var kept []int
+			for len(q.queue) > 0 {
+				kept = append(kept, (<-q.queue).Length)
+			}
+			if fmt.Sprint(kept) != fmt.Sprint(test.kept) {
+				t.Errorf("kept %v, want %v", kept, test.kept)
+			}
+			if dropped := counters.Dropped.Load(); dropped != 2 {
+				t.Errorf("Dropped is %d, want 2", dropped)
+			}
+			if free := len(pool.free); free != 2 {
+				t.Errorf("%d buffers back in the pool, want the 2 of the dropped packets", free)
+			}
+		})
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	counters := &Counters{}
+	pool := newBufferPool(1, 16, counters)
+	first, second := pool.get(), pool.get()
+	if allocations := counters.BufferAllocations.Load(); allocations != 2 {
+		t.Fatalf("BufferAllocations is %d from an empty pool, want 2", allocations)
+	}
+	pool.put(first[:4])
+	pool.put(second) // The pool is full, so it is left to the garbage collector.
+	if buffer := pool.get(); len(buffer) != 16 {
+		t.Errorf("a buffer of %d bytes from the pool, want 16", len(buffer))
+	}
+	if allocations := counters.BufferAllocations.Load(); allocations != 2 {
+		t.Errorf("BufferAllocations is %d after taking a buffer put back, want 2", allocations)
+	}
+	pool.get()
+	if allocations := counters.BufferAllocations.Load(); allocations != 3 {
+		t.Errorf("BufferAllocations is %d when the pool is empty again, want 3", allocations)
+	}
+}
+
+/*
+	Measures the receive path of the sockets: the packets per second it
+	passes to the receive channel, and the memory it allocates for each. The
+	packets are sent on loopback in windows of the size of the receive queue,
+	so none should be dropped.
+*/
+func BenchmarkReceive(b *testing.B) {
+	counters := &Counters{}
+	config := Config{
+		LocalListenPort:     benchmarkPort,
+		BroadcastListenPort: benchmarkPort + 1,
+		MessageSize:         4 * 1024,
+		Loopback:            true,
+		Counters:            counters,
+	}
+	receiveChannel := make(chan UDPMessage)
+	localIP, handle, err := Start(context.Background(), config, make(chan UDPMessage), receiveChannel)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer handle.Close()
+	sender, err := net.DialUDP(udp4, nil, &net.UDPAddr{IP: net.ParseIP(localIP), Port: benchmarkPort})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer sender.Close()
+
+	packet := make([]byte, benchmarkPacketSize)
+	lost := 0
+	b.ReportAllocs()
+	b.SetBytes(int64(len(packet)))
+	timeout := time.NewTimer(benchmarkTimeout)
+	defer timeout.Stop()
+	b.ResetTimer()
+	for sent := 0; sent < b.N; {
+		window := defaultReceiveQueueSize
+		if b.N-sent < window {
+			window = b.N - sent
+		}
+		for i := 0; i < window; i++ {
+			sender.Write(packet)
+		}
+		sent += window
+		for received := 0; received < window; received++ {
+			timeout.Reset(benchmarkTimeout)
+			select {
+			case msg := <-receiveChannel:
+				msg.Release()
+			case <-timeout.C:
+				lost += window - received
+				received = window
+			}
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "packets/s")
+	b.ReportMetric(float64(lost), "lost")
+	b.ReportMetric(float64(counters.Dropped.Load()), "dropped")
+	b.ReportMetric(float64(counters.BufferAllocations.Load()), "buffers")
+}
@@ -0,0 +1,33 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package udp
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+/*
+	Listens on the address with SO_REUSEPORT set, so several elevators on this
+	machine can listen on the same broadcast port. Every one of them receives
+	the broadcasts.
+*/
+func listenReusePort(address *net.UDPAddr) (*net.UDPConn, error) {
+	listenConfig := net.ListenConfig{Control: func(network, address string, rawConnection syscall.RawConn) error {
+		var err error
+		controlErr := rawConnection.Control(func(fd uintptr) {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+		})
+		if controlErr != nil {
+			return controlErr
+		}
+		return err
+	}}
+	connection, err := listenConfig.ListenPacket(context.Background(), udp4, address.String())
+	if err != nil {
+		return nil, err
+	}
+	return connection.(*net.UDPConn), nil
+}
@@ -0,0 +1,5 @@
+package udp
+
+import "syscall"
+
+const soReusePort = syscall.SO_REUSEPORT
@@ -0,0 +1,7 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le && !sparc64
+// +build linux,!mips,!mipsle,!mips64,!mips64le,!sparc64
+
+package udp
+
+// SO_REUSEPORT is missing from the syscall package on Linux for some architectures, like amd64.
+const soReusePort = 0xf
@@ -0,0 +1,9 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+// +build linux
+// +build mips mipsle mips64 mips64le
+
+package udp
+
+import "syscall"
+
+const soReusePort = syscall.SO_REUSEPORT
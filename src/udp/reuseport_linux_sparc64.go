@@ -0,0 +1,4 @@
+package udp
+
+// The socket options of Linux on SPARC have their own numbers.
+const soReusePort = 0x200
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package udp
+
+import (
+	"errors"
+	"net"
+)
+
+func listenReusePort(address *net.UDPAddr) (*net.UDPConn, error) {
+	return nil, errors.New("UDP:\t SO_REUSEPORT is not supported here, use port offsets.")
+}
@@ -0,0 +1,80 @@
+package udp
+
+import (
+	"context"
+	"lifecycle"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+	A socket which can be closed and opened again with the same function when
+	it fails, while the servers are using it. The servers must get the
+	connection again after it is reopened.
+*/
+type socket struct {
+	name   string
+	open   func() (*net.UDPConn, error)
+	mutex  sync.Mutex
+	conn   *net.UDPConn
+	closed bool // Closed for good, it is not opened again.
+}
+
+func openSocket(name string, open func() (*net.UDPConn, error)) (*socket, error) {
+	conn, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &socket{name: name, open: open, conn: conn}, nil
+}
+
+func (s *socket) connection() *net.UDPConn {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.conn
+}
+
+/*
+	Closes the socket and opens it again, trying every restartDelay until it
+	works. The first failure is reported. Returns false if the socket was
+	closed for good or the context was done first.
+*/
+func (s *socket) reopen(ctx context.Context, errorChannel chan<- error) bool {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return false
+	}
+	s.conn.Close()
+	s.mutex.Unlock()
+	for attempt := 0; ; attempt++ {
+		conn, err := s.open()
+		if err == nil {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if s.closed {
+				conn.Close()
+				return false
+			}
+			s.conn = conn
+			return true
+		}
+		if attempt == 0 {
+			lifecycle.Report(errorChannel, &SocketError{Socket: s.name, Op: "open", Err: err})
+		}
+		select {
+		case <-time.After(restartDelay):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Closes the socket for good.
+func (s *socket) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	s.conn.Close()
+}
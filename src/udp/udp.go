@@ -5,9 +5,16 @@ package udp
 	It sets the IP for boradcasting and ports for connections and broadcasting.
 	It expects to receive JSON serialized objects to send and it outputs JSON serialized objects
 	when they are received.
+	The messages to "broadcast" are sent to the broadcast address, or to a multicast group
+	when the Config has one. Multicast crosses subnets with a TTL above 1, and only wakes the
+	hosts that have joined the group.
 */
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"lifecycle"
 	"log"
 	"net"
 	"strconv"
@@ -15,17 +22,78 @@ import (
 
 const debug = false
 const udp4 = "udp4"
-const broadcastIp = "255.255.255.255:"
+const broadcastIp = "255.255.255.255"
+const loopbackIp = "127.0.0.1"
+const loopbackBroadcastIp = "127.255.255.255"
 
-// The adresses used for communicating and broadcast.
-var localAddress *net.UDPAddr
-var broadcastAdress *net.UDPAddr
+/*
+	How to set up the sockets. Only the ports and the message size have to be
+	set, the rest is for running several elevators on one machine:
+		- Loopback keeps everything on this machine, no network is needed.
+		- BindAddress gives each elevator its own IP, for example 127.0.0.2.
+		  With ReusePort they can then share the broadcast port, which works on
+		  loopback with Linux.
+		- Otherwise each elevator gets its own ports with PortOffset, and the
+		  broadcasts are sent to the broadcast port of all LocalElevators.
+	With a MulticastGroup the broadcasts are sent to the group instead, and the
+	broadcast listen port joins the group. Several elevators on one machine can
+	join the same group and port.
+*/
+type Config struct {
+	LocalListenPort     int
+	BroadcastListenPort int
+	MessageSize         int
+	BindAddress         string       // The local IP to listen on. "" finds the IP of the network by dialing the broadcast address.
+	BroadcastAddress    string       // Where broadcasts are sent. "" is 255.255.255.255, or 127.255.255.255 with Loopback.
+	Loopback            bool         // Only talk to elevators on this machine. The local IP is 127.0.0.1 unless BindAddress is set.
+	ReusePort           bool         // Share the broadcast listen port with the other elevators on this machine (SO_REUSEPORT).
+	PortOffset          int          // Added to both listen ports, so the elevators on this machine get their own ports.
+	LocalElevators      int          // The number of elevators on this machine using port offsets 0, 1, ...
+	MulticastGroup      string       // The IPv4 multicast group to use instead of broadcast, for example 239.255.41.45. "" is broadcast.
+	MulticastTTL        int          // How many routers the multicast messages may cross. 0 is 1, this subnet only.
+	MulticastInterface  string       // The name of the network interface to multicast on. "" lets the system choose.
+	ReceiveQueueSize    int          // How many received packets are kept for the receive channel. 0 is 64.
+	DropPolicy          DropPolicy   // Which packet to drop when the receive queue is full.
+	Counters            *Counters    // Counts the received and dropped packets, if not nil.
+	Errors              chan<- error // Where the errors are reported, see errors.go. nil logs them.
+}
 
 // The struct for the messages that are being sendt or received.
 type UDPMessage struct {
 	RAddress string // "broadcast" or some ip address. Return adress when received(the address to return to), receive address when sending(the address which is receiving.)
 	Data     []byte // The data of the sendt or received package(serialized JSON)
 	Length   int    // Lengt of the received data, in bytes. N/A for sending.
+
+	pool   *bufferPool // Where the buffer of a received message goes back on Release.
+	buffer []byte
+}
+
+/*
+	A function connecting the send and receive channels to a network, and returning the local IP.
+	The network module uses one to start the UDP module. It is the channel part of Start, or a Bus
+	for elevators running in the same process. It runs until the context is done, and the handle
+	tells when it has stopped.
+*/
+type Transport func(ctx context.Context, sendChannel <-chan UDPMessage, receiveChannel chan<- UDPMessage) (localIP string, handle *lifecycle.Handle, err error)
+
+/*
+	Starts the Transport under a decorator, like the FaultInjector, with the handle of the decorator.
+	The next Transport is stopped when the goroutines of the handle have stopped, so the messages
+	they pass on when the context is done are sent before it stops.
+*/
+func StartNext(ctx context.Context, handle *lifecycle.Handle, next Transport, sendChannel <-chan UDPMessage, receiveChannel chan<- UDPMessage) (localIP string, err error) {
+	nextCtx, stopNext := context.WithCancel(context.WithoutCancel(ctx))
+	localIP, nextHandle, err := next(nextCtx, sendChannel, receiveChannel)
+	if err != nil {
+		stopNext()
+		handle.Close()
+		return "", err
+	}
+	handle.Cleanup(func() {
+		stopNext()
+		nextHandle.Wait()
+	})
+	return localIP, nil
 }
 
 /*
@@ -33,157 +101,312 @@ type UDPMessage struct {
 	for communicating with the calling module. It returns the local IP-address of this system/module, and an error if if it fails(then ip is "").
 */
 func Init(localListenPort, broadcastListenPort, messageSize int, sendChannel <-chan UDPMessage, receiveChannel chan<- UDPMessage) (localIP string, err error) {
+	config := Config{LocalListenPort: localListenPort, BroadcastListenPort: broadcastListenPort, MessageSize: messageSize}
+	return InitConfig(config, sendChannel, receiveChannel)
+}
 
-	// Generate broadcast address
-	broadcastAdress, err = net.ResolveUDPAddr(udp4, broadcastIp+strconv.Itoa(broadcastListenPort))
-	if err != nil {
-		log.Println("UDP:\t Could not resolve UDPAddress.")
-		return "", err
-	} else if debug {
-		// We are in debug mode.
-		log.Printf("UDP:\t Generating broadcast address:\t %s \n", broadcastAdress.String())
+// Returns a Transport which starts the UDP module with the config.
+func ConfigTransport(config Config) Transport {
+	return func(ctx context.Context, sendChannel <-chan UDPMessage, receiveChannel chan<- UDPMessage) (string, *lifecycle.Handle, error) {
+		return Start(ctx, config, sendChannel, receiveChannel)
 	}
+}
 
-	// Generate local address, uses the tempConnection to fetch address via the UDP dial.
-	tempConnection, err := net.DialUDP(udp4, nil, broadcastAdress)
-	if err != nil {
-		log.Println("UDP:\t No network connection")
-		return "", err
+// Initializes the UDP module like Init, with the addresses and ports set up by the config. It runs forever.
+func InitConfig(config Config, sendChannel <-chan UDPMessage, receiveChannel chan<- UDPMessage) (localIP string, err error) {
+	localIP, _, err = Start(context.Background(), config, sendChannel, receiveChannel)
+	return localIP, err
+}
+
+/*
+	Starts the UDP module with the addresses and ports set up by the config.
+	The returned local IP identifies this elevator, so with several LocalElevators it is
+	"ip:port", the same as the return address of the messages from it.
+	It runs until the context is done or the handle is closed. Then it sends what is left
+	on the sendChannel, and closes the sockets.
+*/
+func Start(ctx context.Context, config Config, sendChannel <-chan UDPMessage, receiveChannel chan<- UDPMessage) (localIP string, handle *lifecycle.Handle, err error) {
+	localListenPort := config.LocalListenPort + config.PortOffset
+	broadcastListenPort := config.BroadcastListenPort + config.PortOffset
+	if config.LocalElevators > 1 {
+		distance := config.BroadcastListenPort - config.LocalListenPort
+		if distance < config.LocalElevators && -distance < config.LocalElevators {
+			return "", nil, fmt.Errorf("UDP:\t The ports of %d elevators from %d and %d overlap.", config.LocalElevators, config.LocalListenPort, config.BroadcastListenPort)
+		}
+	}
+
+	multicast := config.MulticastGroup != ""
+	var multicastInterface *net.Interface
+	if multicast {
+		if group := net.ParseIP(config.MulticastGroup); group == nil || group.To4() == nil || !group.IsMulticast() {
+			return "", nil, fmt.Errorf("UDP:\t %q is not an IPv4 multicast group.", config.MulticastGroup)
+		}
+		if config.MulticastInterface != "" {
+			multicastInterface, err = net.InterfaceByName(config.MulticastInterface)
+			if err != nil {
+				log.Println("UDP:\t Could not find the multicast interface.")
+				return "", nil, err
+			}
+		}
+	}
+
+	// Generate broadcast addresses, one for each elevator on this machine with its own ports.
+	broadcastHost := config.BroadcastAddress
+	if multicast {
+		broadcastHost = config.MulticastGroup
+	} else if broadcastHost == "" && config.Loopback {
+		broadcastHost = loopbackBroadcastIp
+	} else if broadcastHost == "" {
+		broadcastHost = broadcastIp
 	}
-	defer tempConnection.Close() // Makes sure the connection is closed when Init completes.
-	tempAddress := tempConnection.LocalAddr()
-	localAddress, err = net.ResolveUDPAddr(udp4, tempAddress.String())
+	var broadcastAddresses []*net.UDPAddr
+	for offset := 0; offset < config.LocalElevators || offset == 0; offset++ {
+		port := config.BroadcastListenPort + offset
+		if config.LocalElevators == 0 {
+			port = broadcastListenPort
+		}
+		broadcastAddress, err := net.ResolveUDPAddr(udp4, net.JoinHostPort(broadcastHost, strconv.Itoa(port)))
+		if err != nil {
+			log.Println("UDP:\t Could not resolve UDPAddress.")
+			return "", nil, err
+		} else if debug {
+			// We are in debug mode.
+			log.Printf("UDP:\t Generating broadcast address:\t %s \n", broadcastAddress.String())
+		}
+		broadcastAddresses = append(broadcastAddresses, broadcastAddress)
+	}
+
+	// Generate local address, uses the tempConnection to fetch address via the UDP dial if it is not given.
+	bindAddress := config.BindAddress
+	if bindAddress == "" && config.Loopback {
+		bindAddress = loopbackIp
+	} else if bindAddress == "" && multicastInterface != nil {
+		bindAddress, err = interfaceIPv4(multicastInterface)
+		if err != nil {
+			return "", nil, err
+		}
+	} else if bindAddress == "" {
+		tempConnection, err := net.DialUDP(udp4, nil, broadcastAddresses[0])
+		if err != nil {
+			log.Println("UDP:\t No network connection")
+			return "", nil, err
+		}
+		bindAddress, _, _ = net.SplitHostPort(tempConnection.LocalAddr().String())
+		tempConnection.Close()
+	}
+	localAddress, err := net.ResolveUDPAddr(udp4, net.JoinHostPort(bindAddress, strconv.Itoa(localListenPort)))
 	if err != nil {
 		log.Println("UDP:\t Could not resolve local address.")
-		return "", err
+		return "", nil, err
 	} else if debug {
 		log.Printf("UDP:\t Generating local address: \t%s \n", localAddress.String())
 	}
-	localAddress.Port = localListenPort // Set the port property of the *net.UDPAddr struct
 
 	// Create local listening connections
-	localListenConnection, err := net.ListenUDP(udp4, localAddress) // Listens for incoming UDP packets addressed to localAddress.
+	localListenSocket, err := openSocket("local", func() (*net.UDPConn, error) {
+		connection, err := net.ListenUDP(udp4, localAddress) // Listens for incoming UDP packets addressed to localAddress.
+		if err != nil || !multicast {
+			return connection, err
+		}
+		ttl := config.MulticastTTL
+		if ttl == 0 {
+			ttl = 1
+		}
+		if err := setMulticastOptions(connection, multicastInterface, ttl); err != nil {
+			connection.Close()
+			return nil, err
+		}
+		return connection, nil
+	})
 	if err != nil {
 		log.Println("UDP:\t Couldn't create a UDP listener socket.")
-		return "", err
+		return "", nil, err
 	}
 	if debug {
 		log.Println("UDP:\t Created a UDP listener socket.")
 	}
 
-	// Create a listener on broadcast connection.
-	broadcastListenConnection, err := net.ListenUDP(udp4, &net.UDPAddr{IP: net.IPv4(0, 0, 0, 0), Port: broadcastListenPort})
+	// Create a listener on broadcast connection, or join the multicast group.
+	broadcastListenAddress := &net.UDPAddr{IP: net.IPv4(0, 0, 0, 0), Port: broadcastListenPort}
+	broadcastListenSocket, err := openSocket("broadcast", func() (*net.UDPConn, error) {
+		if multicast {
+			groupAddress := &net.UDPAddr{IP: net.ParseIP(config.MulticastGroup), Port: broadcastListenPort}
+			return net.ListenMulticastUDP(udp4, multicastInterface, groupAddress)
+		} else if config.ReusePort {
+			return listenReusePort(broadcastListenAddress)
+		}
+		return net.ListenUDP(udp4, broadcastListenAddress)
+	})
 	if err != nil {
 		log.Println("UDP:\t Could not create a UDP broadcast listen socket.")
-		localListenConnection.Close()
-		return "", err
+		localListenSocket.close()
+		return "", nil, err
 	}
 	if debug {
 		log.Println("UDP:\t Created a UDP broadcast listen socket.")
 	}
 	// Start goroutines to handle incoming messages and sending outgoing messages.
-	go udpReceiveServer(localListenConnection, broadcastListenConnection, messageSize, receiveChannel)
-	go udpTransmitServer(localListenConnection, broadcastListenConnection, localListenPort, broadcastListenPort, sendChannel)
-	return localAddress.IP.String(), err
+	counters := config.Counters
+	if counters == nil {
+		counters = &Counters{}
+	}
+	queueSize := config.ReceiveQueueSize
+	if queueSize == 0 {
+		queueSize = defaultReceiveQueueSize
+	}
+	queue := newReceiveQueue(queueSize, config.DropPolicy, counters)
+	pool := newBufferPool(queueSize+2, config.MessageSize, counters)
+	errorChannel := config.Errors
+	handle, ctx = lifecycle.New(ctx)
+	transmitDone := make(chan struct{})
+	handle.Go(func() {
+		serve(ctx, "receive server", errorChannel, func() { udpReceiveServer(ctx, queue, receiveChannel) })
+	})
+	for _, s := range []*socket{localListenSocket, broadcastListenSocket} {
+		s := s
+		handle.Go(func() {
+			serve(ctx, s.name+" reader", errorChannel, func() { udpConnectionReader(ctx, s, pool, queue, errorChannel) })
+		})
+	}
+	handle.Go(func() {
+		serve(ctx, "transmit server", errorChannel, func() {
+			udpTransmitServer(ctx, localListenSocket, broadcastAddresses, sendChannel, errorChannel)
+		})
+		close(transmitDone)
+	})
+	handle.Go(func() {
+		<-ctx.Done()
+		<-transmitDone
+		localListenSocket.close()
+		broadcastListenSocket.close()
+	})
+	if config.LocalElevators > 1 {
+		return localAddress.String(), handle, nil
+	}
+	return localAddress.IP.String(), handle, nil
+}
+
+// Returns the first IPv4 address of the network interface.
+func interfaceIPv4(networkInterface *net.Interface) (string, error) {
+	addresses, err := networkInterface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	for _, address := range addresses {
+		if ipNet, ok := address.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+	}
+	return "", fmt.Errorf("UDP:\t The interface %s has no IPv4 address.", networkInterface.Name)
 }
 
 /*
 	This function is called as a goroutine and acts as a server used for sending UDP packets. It receives the packets to send via
-	the sendChannel, and runs an infinite loop waiting for messages to send.
+	the sendChannel, and runs a loop waiting for messages to send until the context is done. Then it sends the messages
+	left on the sendChannel. A message to a bad address is reported and dropped. The broadcast errors are only
+	reported to an error channel, or in debug mode, as they come every time the network is down.
 */
-func udpTransmitServer(localConnection, broadcastConnection *net.UDPConn, localListenPort, broadcastListenPort int, sendChannel <-chan UDPMessage) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("UDPConnectionReader:\t Error in UDPTransmitServer: %s \n Closing connection.", r)
-			localConnection.Close()
-			broadcastConnection.Close()
-		}
-	}()
+func udpTransmitServer(ctx context.Context, localSocket *socket, broadcastAddresses []*net.UDPAddr, sendChannel <-chan UDPMessage, errorChannel chan<- error) {
 	for {
 		if debug {
 			log.Println("UDPTransmitServer:\t Waiting on new value on sendChannel.")
 		}
+		var msg UDPMessage
 		select { // Waits for something to happen on the sendChannel
-		case msg := <-sendChannel:
-			if debug {
-				log.Println("UDPTransmitServer:\t Start sending an ElevState package to: ", msg.RAddress)
-				log.Println("UDP-Send:\t", string(msg.Data))
+		case <-ctx.Done():
+			select {
+			case msg = <-sendChannel:
+			default:
+				return
 			}
-			if msg.RAddress == "broadcast" { // Broadcast the message
-				bytesSended, err := localConnection.WriteToUDP(msg.Data, broadcastAdress)
-				if (err != nil || bytesSended < 0) && debug {
-					log.Println("UDPTransmitServer:\t Error ending broadcast message.")
-					log.Println(err)
-				}
-			} else { // Send the message to the localConnection. p2p
-				returnAddress, err := net.ResolveUDPAddr("udp", msg.RAddress)
-				if err != nil {
-					log.Println("UDPTransmitServer:\t Could not resolve return address.")
-					log.Fatal(err)
-				}
-				if n, err := localConnection.WriteToUDP(msg.Data, returnAddress); err != nil || n < 0 {
-					log.Printf("UDPTransmiServer:\t Error: Sending p2p message.")
-					log.Println(err)
+		case msg = <-sendChannel:
+		}
+		if debug {
+			log.Println("UDPTransmitServer:\t Start sending an ElevState package to: ", msg.RAddress)
+			log.Println("UDP-Send:\t", string(msg.Data))
+		}
+		if msg.RAddress == "broadcast" { // Broadcast the message
+			for _, broadcastAddress := range broadcastAddresses {
+				_, err := localSocket.connection().WriteToUDP(msg.Data, broadcastAddress)
+				if err != nil && (errorChannel != nil || debug) {
+					lifecycle.Report(errorChannel, &SocketError{Socket: localSocket.name, Op: "write", Err: err})
 				}
 			}
+		} else { // Send the message to the localConnection. p2p
+			returnAddress, err := net.ResolveUDPAddr("udp", msg.RAddress)
+			if err != nil {
+				lifecycle.Report(errorChannel, &AddressError{Address: msg.RAddress, Err: err})
+				continue
+			}
+			if _, err := localSocket.connection().WriteToUDP(msg.Data, returnAddress); err != nil {
+				lifecycle.Report(errorChannel, &SocketError{Socket: localSocket.name, Op: "write", Err: err})
+			}
 		}
 	}
 }
 
 /*
 	This function is called as a goroutine and acts as a server used for receiving UDP packets. It sends the packets received via
-	the receiveChannel. It starts two goroutines used for listening on connections and broadcasts for incoming UDP packets.
-	These are then sendt via two different channels to the ReceiveServer, depending on the incoming message type(p2p or broadcast.)
+	the receiveChannel. The readers listening on connections and broadcasts put the packets in the queue, which is emptied here
+	into the receiveChannel until the context is done.
 */
-func udpReceiveServer(localConnection, broadcastConnection *net.UDPConn, messageSize int, receiveChannel chan<- UDPMessage) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Println("UDP:\t ERROR in UDPReceiveServer: %s \n Closing connection.", r)
-			localConnection.Close()
-			broadcastConnection.Close()
-		}
-	}()
-	broadcastConnectionReceiveChannel := make(chan UDPMessage)
-	localConnectionReceiveChannel := make(chan UDPMessage)
-	// Run the goroutines.
-	go udpConnectionReader(localConnection, messageSize, localConnectionReceiveChannel)
-	go udpConnectionReader(broadcastConnection, messageSize, broadcastConnectionReceiveChannel)
+func udpReceiveServer(ctx context.Context, queue *receiveQueue, receiveChannel chan<- UDPMessage) {
 	for {
-		select { // Wait for messages from the above goroutines.
-		case message := <-broadcastConnectionReceiveChannel:
-			receiveChannel <- message
-		case message := <-localConnectionReceiveChannel:
-			receiveChannel <- message
+		select { // Wait for messages from the readers.
+		case <-ctx.Done():
+			return
+		case message := <-queue.queue:
+			select {
+			case receiveChannel <- message:
+			case <-ctx.Done():
+				message.Release()
+				return
+			}
 		}
 	}
 }
 
 /*
-	Used to listen for incoming UDP packets on  an given connection. Runs an infinite loop reading from the connection to a buffer.
-	When a message is complete, it sends it to to the caller via the receive channel.
+	Used to listen for incoming UDP packets on  an given socket. Runs an infinite loop reading from the socket to a buffer
+	from the pool. When a message is complete, it puts it in the queue without waiting. The errors are reported, and the
+	socket is opened again when it has been closed or fails maxReadErrors times in a row. It stops when the socket is
+	closed after the context is done.
 */
-func udpConnectionReader(connection *net.UDPConn, messageSize int, receiveChannel chan<- UDPMessage) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Println("UDPConnectionReader:\t ERROR in udpConnectionReader:\t %s \n Closig connection.", r)
-			connection.Close()
-		}
-	}()
-
+func udpConnectionReader(ctx context.Context, socket *socket, pool *bufferPool, queue *receiveQueue, errorChannel chan<- error) {
+	addresses := make(addressCache)
+	failures := 0
 	for {
+		connection := socket.connection()
 		if debug {
 			log.Printf("UDPConnectionReader:\t Waiting on data from UDPConnection %s\n", connection.LocalAddr().String())
 		}
-		buffer := make([]byte, messageSize) // TODO: Do without allocation memory each time!
-		n, returnAddress, err := connection.ReadFromUDP(buffer)
-		if err != nil || n < 0 || n > messageSize {
-			log.Println("UDPConnectionReader:\t Error in ReadFromUDP:", err)
+		buffer := pool.get()
+		n, returnAddress, err := connection.ReadFromUDPAddrPort(buffer)
+		if err != nil && ctx.Err() != nil {
+			pool.put(buffer)
+			return
+		} else if err != nil {
+			queue.counters.ReadErrors.Add(1)
+			pool.put(buffer)
+			failures++
+			if errors.Is(err, net.ErrClosed) || failures >= maxReadErrors {
+				reopened := socket.reopen(ctx, errorChannel)
+				lifecycle.Report(errorChannel, &SocketError{Socket: socket.name, Op: "read", Err: err, Reopened: reopened})
+				if !reopened {
+					return
+				}
+				failures = 0
+			} else {
+				lifecycle.Report(errorChannel, &SocketError{Socket: socket.name, Op: "read", Err: err})
+			}
 		} else {
 			if debug {
 				log.Println("UDPConnectionReader:\t Received package from:", returnAddress.String())
-				log.Println("UDP-Listen:\t", string(buffer[:]))
+				log.Println("UDP-Listen:\t", string(buffer[:n]))
 			}
-			receiveChannel <- UDPMessage{RAddress: returnAddress.String(), Data: buffer[:n], Length: n}
+			failures = 0
+			queue.counters.Received.Add(1)
+			queue.push(UDPMessage{RAddress: addresses.lookup(returnAddress), Data: buffer[:n], Length: n, pool: pool, buffer: buffer})
 		}
 	}
 }